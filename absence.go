@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	FilterTypeMatch   = "match"
+	FilterTypeAbsence = "absence"
+
+	// the default expected period of the scheduled absence check
+	defaultAbsenceSchedulePeriod = 24 * time.Hour
+)
+
+// Absence alerts when the filter records stop appearing:
+// no records are matched within the expected period, or before the daily scheduled time
+// within the expected period. With modTime the log source activity is checked
+// instead of the matched records, e.g. the log file modification time
+type Absence struct {
+	expectEvery time.Duration
+	schedule    *time.Duration
+	modTime     bool
+}
+
+// absenceState is the last activity of the filter, persisted by the processor
+type absenceState struct {
+	LastSeen time.Time `json:"lastSeen"`
+	// the last scheduled check time
+	Checked time.Time `json:"checked,omitempty"`
+	Firing  bool      `json:"firing,omitempty"`
+}
+
+// NewAbsence returns nil if the filter type is not absence
+func NewAbsence(cfg FilterConfig) (*Absence, error) {
+	switch cfg.Type {
+	case "", FilterTypeMatch:
+		return nil, nil
+	case FilterTypeAbsence:
+	default:
+		return nil, fmt.Errorf("filter type '%s' is unsupported", cfg.Type)
+	}
+
+	a := &Absence{
+		expectEvery: time.Second * time.Duration(cfg.ExpectEverySec),
+		modTime:     cfg.ModTime,
+	}
+
+	if cfg.Schedule != "" {
+		t, err := time.Parse("15:04", cfg.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("absence schedule '%s' is not in HH:MM format", cfg.Schedule)
+		}
+
+		schedule := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		a.schedule = &schedule
+
+		if a.expectEvery == 0 {
+			a.expectEvery = defaultAbsenceSchedulePeriod
+		}
+	}
+
+	if a.expectEvery == 0 {
+		return nil, fmt.Errorf("absence expectEvery is not set")
+	}
+
+	return a, nil
+}
+
+// check updates the state with the last activity time (zero if there was no activity)
+// and reports whether the absence alert fires or is resolved
+func (a *Absence) check(state *absenceState, lastSeen, now time.Time) (fire bool, resolve bool) {
+	if state.LastSeen.IsZero() {
+		// the absence is tracked from the first start
+		if lastSeen.IsZero() {
+			lastSeen = now
+		}
+		state.LastSeen, state.Checked = lastSeen, now
+	}
+
+	if lastSeen.After(state.LastSeen) {
+		state.LastSeen = lastSeen
+
+		if state.Firing {
+			state.Firing = false
+			return false, true
+		}
+	}
+
+	if state.Firing {
+		return false, false
+	}
+
+	if a.schedule == nil {
+		state.Firing = now.Sub(state.LastSeen) > a.expectEvery
+		return state.Firing, false
+	}
+
+	deadline := a.lastScheduled(now)
+	if !deadline.After(state.Checked) {
+		return false, false
+	}
+
+	state.Checked = deadline
+	state.Firing = deadline.Sub(state.LastSeen) > a.expectEvery
+
+	return state.Firing, false
+}
+
+// lastScheduled returns the last daily scheduled time before now in the local time zone
+func (a *Absence) lastScheduled(now time.Time) time.Time {
+	year, month, day := now.Date()
+	scheduled := time.Date(year, month, day, 0, 0, 0, 0, now.Location()).Add(*a.schedule)
+
+	if scheduled.After(now) {
+		scheduled = scheduled.AddDate(0, 0, -1)
+	}
+
+	return scheduled
+}
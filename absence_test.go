@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAbsence(t *testing.T) {
+	start := time.Date(2023, 10, 12, 10, 0, 0, 0, time.Local)
+
+	type check struct {
+		afterMin int
+		activity int // minutes after start, -1 - no activity
+		fire     bool
+		resolve  bool
+	}
+
+	tests := []struct {
+		name   string
+		cfg    FilterConfig
+		checks []check
+	}{
+		{
+			"1. Expected period",
+			FilterConfig{Type: FilterTypeAbsence, ExpectEverySec: 3600},
+			[]check{
+				{0, -1, false, false},
+				{30, 30, false, false},
+				{90, -1, false, false},
+				{91, -1, true, false},
+				// fired once
+				{120, -1, false, false},
+				{121, 121, false, true},
+			},
+		},
+		{
+			"2. Daily schedule",
+			FilterConfig{Type: FilterTypeAbsence, Schedule: "03:00", ExpectEverySec: 6 * 3600},
+			[]check{
+				{0, -1, false, false},
+				// 2023-10-13 01:00
+				{15 * 60, 15 * 60, false, false},
+				// 2023-10-13 03:00, the record appeared 2 hours ago
+				{17 * 60, -1, false, false},
+				// 2023-10-14 03:30, no records within 6 hours before 03:00
+				{41*60 + 30, -1, true, false},
+				{42 * 60, 42 * 60, false, true},
+			},
+		},
+		{
+			"3. Modification time",
+			FilterConfig{Type: FilterTypeAbsence, ExpectEverySec: 600, ModTime: true},
+			[]check{
+				// the file wasn't modified for too long before start
+				{0, -20, true, false},
+				{1, -20, false, false},
+				{2, 2, false, true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			absence, err := NewAbsence(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			state := &absenceState{}
+
+			for i, c := range tt.checks {
+				var lastSeen time.Time
+				if c.activity != -1 {
+					lastSeen = start.Add(time.Duration(c.activity) * time.Minute)
+				}
+
+				fire, resolve := absence.check(state, lastSeen, start.Add(time.Duration(c.afterMin)*time.Minute))
+				if fire != c.fire || resolve != c.resolve {
+					t.Errorf("check %d: got fire %v resolve %v, expected %v %v", i+1, fire, resolve, c.fire, c.resolve)
+				}
+			}
+		})
+	}
+}
+
+func TestAbsenceConfigError(t *testing.T) {
+	configs := []FilterConfig{
+		{Type: "unknown"},
+		{Type: FilterTypeAbsence},
+		{Type: FilterTypeAbsence, Schedule: "25:00"},
+	}
+
+	for _, cfg := range configs {
+		if _, err := NewAbsence(cfg); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
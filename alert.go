@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+)
+
+// alertState is the firing alert of the threshold or absence filter, persisted by the processor.
+// The resolved messages have the alert ID and the notifier references
+// of the firing message, so the notifiers can correlate them
+type alertState struct {
+	ID    string    `json:"id"`
+	Since time.Time `json:"since"`
+	// the last firing message time
+	Notified time.Time `json:"notified"`
+	// the number of the repeated firing messages
+	Repeats int               `json:"repeats,omitempty"`
+	Text    string            `json:"text,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	// the firing message references by notifier name, e.g. telegram message ID
+	Refs map[string]string `json:"refs,omitempty"`
+}
+
+// alertKey returns the key of the filter alert for the group key
+func alertKey(filterName, groupKey string) string {
+	if groupKey == "" {
+		return filterName
+	}
+	return filterName + "\x00" + groupKey
+}
+
+// alertGroupKey returns the group key of the filter alert key, false if it's another filter key
+func alertGroupKey(key, filterName string) (string, bool) {
+	if key == filterName {
+		return "", true
+	}
+	prefix := filterName + "\x00"
+	if !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+	return key[len(prefix):], true
+}
+
+// startAlert makes the message the firing message of the new alert.
+// The alert is kept only if the message is sent, the processor state is rolled back otherwise,
+// so the alert starts again on the next check. Returns false if the alert is already firing
+func (p *Processor) startAlert(key string, msg *Message, now time.Time) bool {
+	if _, ok := p.state.Alerts[key]; ok {
+		return false
+	}
+
+	if p.state.Alerts == nil {
+		p.state.Alerts = make(map[string]*alertState)
+	}
+
+	// the firing message sent before the failed send has the ID already
+	id, ok := p.deliveredAlerts[key]
+	if !ok {
+		id = fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%s:%s:%d", p.filePath, key, now.UnixNano()))))[:16]
+	}
+
+	alert := &alertState{
+		ID:       id,
+		Since:    now,
+		Notified: now,
+		Text:     msg.Text,
+		Fields:   msg.Fields,
+		Refs:     make(map[string]string),
+	}
+
+	p.state.Alerts[key] = alert
+	p.stateChanged = true
+
+	msg.AlertID = alert.ID
+	msg.Refs = alert.Refs
+
+	return true
+}
+
+// repeatAlert makes the message the repeated firing message of the alert
+// if the repeat interval passed since the last firing message.
+// Returns false if the alert is not firing or the message is not repeated
+func (p *Processor) repeatAlert(key string, msg *Message, repeatInterval time.Duration, now time.Time) bool {
+	alert, ok := p.state.Alerts[key]
+	if !ok || repeatInterval == 0 || now.Sub(alert.Notified) < repeatInterval {
+		return false
+	}
+
+	alert.Notified = now
+	alert.Repeats++
+	p.stateChanged = true
+
+	msg.AlertID = alert.ID
+	msg.Refs = alert.Refs
+	msg.Repeat = alert.Repeats
+
+	return true
+}
+
+// resolveAlert makes the message the resolved message of the firing alert.
+// Returns the alert or nil if the alert is not firing
+func (p *Processor) resolveAlert(key string, msg *Message) *alertState {
+	alert, ok := p.state.Alerts[key]
+	if !ok {
+		return nil
+	}
+
+	delete(p.state.Alerts, key)
+	p.stateChanged = true
+
+	msg.AlertID = alert.ID
+	msg.Refs = alert.Refs
+	msg.Resolved = true
+
+	return alert
+}
@@ -13,7 +13,7 @@ type App struct {
 	config    Config
 	notifiers []Notifier
 	filters   []*Filter
-	watchers  []*Watcher
+	sources   []Source
 }
 
 func NewApp(cfg Config) *App {
@@ -32,23 +32,32 @@ func (app *App) BuildNotifiers() *App {
 }
 
 func (app *App) BuildFilters() *App {
+	grok, err := NewGrok(app.config.Grok)
+	if err != nil {
+		log.Fatalf("[ERROR] NewGrok error: %v", err)
+	}
+
 	for _, filterCfg := range app.config.Filters {
-		filter, err := NewFilter(filterCfg, app.config.Hostname, app.notifiers)
+		filter, err := NewFilter(filterCfg, app.config.Hostname, app.notifiers, grok)
 		if err != nil {
 			log.Fatalf("[ERROR] NewFilter error: %v", err)
 		}
 		app.filters = append(app.filters, filter)
 	}
+
+	if err := ResolveFilters(app.filters); err != nil {
+		log.Fatalf("[ERROR] ResolveFilters error: %v", err)
+	}
 	return app
 }
 
-func (app *App) BuildWatchers() *App {
+func (app *App) BuildSources() *App {
 	for _, fileCfg := range app.config.Files {
-		watcher, err := NewWatcher(fileCfg, app.filters)
+		source, err := NewSource(fileCfg, app.filters)
 		if err != nil {
-			log.Fatalf("[ERROR] NewWatcher error: %v", err)
+			log.Fatalf("[ERROR] NewSource error: %v", err)
 		}
-		app.watchers = append(app.watchers, watcher)
+		app.sources = append(app.sources, source)
 	}
 	return app
 }
@@ -63,10 +72,10 @@ func (app *App) Watch() {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	wg := sync.WaitGroup{}
-	wg.Add(len(app.watchers))
+	wg.Add(len(app.sources))
 
-	for _, watcher := range app.watchers {
-		go watcher.watch(ctx, &wg)
+	for _, source := range app.sources {
+		go source.watch(ctx, &wg)
 	}
 
 	interrupt := <-stopChan
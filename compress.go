@@ -0,0 +1,43 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedExts are extensions of the compressed rotated files
+var compressedExts = []string{".gz", ".zst"}
+
+func isCompressed(path string) bool {
+	ext := filepath.Ext(path)
+	for _, compressedExt := range compressedExts {
+		if ext == compressedExt {
+			return true
+		}
+	}
+	return false
+}
+
+// decompress returns the reader of the decompressed file data.
+// Data of the not compressed file is returned as is
+func decompress(r io.Reader, path string) (io.ReadCloser, error) {
+	switch filepath.Ext(path) {
+	case ".gz":
+		gzReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return gzReader, nil
+	case ".zst":
+		zstdReader, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReader.IOReadCloser(), nil
+	}
+
+	return io.NopCloser(r), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// conditionOperators are ordered so that the longer operators are checked first
+var conditionOperators = []string{"==", "!=", ">=", "<=", "=~", "!~", ">", "<"}
+
+// Condition is a record field predicate, e.g.:
+// level == "error", http.status >= 500, msg =~ /timeout/
+type Condition struct {
+	Field string
+	Op    string
+	Value string
+	reg   *regexp.Regexp
+}
+
+func NewCondition(expr string) (*Condition, error) {
+	expr = strings.TrimSpace(expr)
+
+	fieldEnd := strings.IndexAny(expr, " =!<>")
+	if fieldEnd <= 0 {
+		return nil, fmt.Errorf("condition '%s' field is not found", expr)
+	}
+
+	c := &Condition{Field: expr[:fieldEnd]}
+	rest := strings.TrimSpace(expr[fieldEnd:])
+
+	for _, op := range conditionOperators {
+		if strings.HasPrefix(rest, op) {
+			c.Op = op
+			break
+		}
+	}
+
+	if c.Op == "" {
+		return nil, fmt.Errorf("condition '%s' operator is not found", expr)
+	}
+
+	value := strings.TrimSpace(rest[len(c.Op):])
+
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("condition '%s' value error: %v", expr, err)
+		}
+		c.Value = unquoted
+	case (c.Op == "=~" || c.Op == "!~") && len(value) >= 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/"):
+		c.Value = value[1 : len(value)-1]
+	default:
+		c.Value = value
+	}
+
+	if c.Op == "=~" || c.Op == "!~" {
+		var err error
+		c.reg, err = regexp.Compile(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("condition '%s' pattern compile error: %v", expr, err)
+		}
+	}
+
+	return c, nil
+}
+
+// Match reports whether the field value satisfies the condition.
+// Values are compared as numbers if both are numbers.
+// Records without the field don't match
+func (c *Condition) Match(fields map[string]string) bool {
+	value, ok := fields[c.Field]
+	if !ok {
+		return false
+	}
+
+	switch c.Op {
+	case "=~":
+		return c.reg.MatchString(value)
+	case "!~":
+		return !c.reg.MatchString(value)
+	}
+
+	fieldNum, fieldErr := strconv.ParseFloat(value, 64)
+	condNum, condErr := strconv.ParseFloat(c.Value, 64)
+	isNumbers := fieldErr == nil && condErr == nil
+
+	switch c.Op {
+	case "==":
+		if isNumbers {
+			return fieldNum == condNum
+		}
+		return value == c.Value
+	case "!=":
+		if isNumbers {
+			return fieldNum != condNum
+		}
+		return value != c.Value
+	}
+
+	if !isNumbers {
+		return false
+	}
+
+	switch c.Op {
+	case ">":
+		return fieldNum > condNum
+	case ">=":
+		return fieldNum >= condNum
+	case "<":
+		return fieldNum < condNum
+	case "<=":
+		return fieldNum <= condNum
+	}
+
+	return false
+}
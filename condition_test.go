@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCondition(t *testing.T) {
+	fields := map[string]string{
+		"level":       "error",
+		"http.status": "503",
+		"msg":         "upstream timeout",
+		"dur":         "5.2s",
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected bool
+	}{
+		{"1. Quoted string equal", `level == "error"`, true},
+		{"2. Bare string not equal", `level != error`, false},
+		{"3. Number greater or equal", `http.status >= 500`, true},
+		{"4. Number less", `http.status < 500`, false},
+		{"5. Numbers equal", `http.status == 503.0`, true},
+		{"6. Regex match", `msg =~ /time(out)?/`, true},
+		{"7. Regex not match", `msg !~ "^upstream"`, false},
+		{"8. Missing field", `user.id == 1`, false},
+		{"9. Not number compare", `dur > 5`, false},
+		{"10. Without spaces", `level=="error"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCondition(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Match(fields); got != tt.expected {
+				t.Errorf("got %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConditionParseError(t *testing.T) {
+	for _, expr := range []string{"", "level", `== "error"`, "level ~ x", `msg =~ /(/`, `level == "error`} {
+		if _, err := NewCondition(expr); err == nil {
+			t.Errorf("expected error for condition '%s'", expr)
+		}
+	}
+}
@@ -8,32 +8,64 @@ import (
 )
 
 type FilterConfig struct {
-	Name          string   `yaml:"name"`
-	Pattern       string   `yaml:"pattern"`
-	Exceptions    []string `yaml:"exceptions"`
-	Message       string   `yaml:"message"`
-	Subject       string   `yaml:"subject"`
-	Notifications []string `yaml:"notifications"`
+	Name          string            `yaml:"name"`
+	Type          string            `yaml:"type"`
+	Pattern       string            `yaml:"pattern"`
+	Exceptions    []string          `yaml:"exceptions"`
+	Fields        map[string]string `yaml:"fields"`
+	Conditions    []string          `yaml:"conditions"`
+	Match         *MatchConfig      `yaml:"match"`
+	GroupBy       []string          `yaml:"groupBy"`
+	ContextBefore uint              `yaml:"contextBefore"`
+	ContextAfter  uint              `yaml:"contextAfter"`
+	Threshold     ThresholdConfig   `yaml:"threshold"`
+	// absence filter
+	ExpectEverySec uint   `yaml:"expectEvery"`
+	Schedule       string `yaml:"schedule"`
+	ModTime        bool   `yaml:"modTime"`
+	// identical messages suppression period
+	CooldownSec uint `yaml:"cooldown"`
+	// firing threshold and absence alerts repeat interval
+	RepeatIntervalSec uint     `yaml:"repeatInterval"`
+	Message           string   `yaml:"message"`
+	Subject           string   `yaml:"subject"`
+	Notifications     []string `yaml:"notifications"`
+	// message templates by notification name
+	Templates map[string]TemplateConfig `yaml:"templates"`
 }
 
 type FileConfig struct {
-	Name           string   `yaml:"name"`
-	Path           string   `yaml:"path"`
-	DateFormat     string   `yaml:"dateFormat"`
-	ReadBufferSize string   `yaml:"readBufferSize"`
-	IntervalSec    uint     `yaml:"interval"`
-	Filters        []string `yaml:"filters"`
+	Name                string            `yaml:"name"`
+	Type                string            `yaml:"type"`
+	Path                string            `yaml:"path"`
+	Format              string            `yaml:"format"`
+	DateFormat          string            `yaml:"dateFormat"`
+	ReadBufferSize      string            `yaml:"readBufferSize"`
+	IntervalSec         uint              `yaml:"interval"`
+	Inotify             bool              `yaml:"inotify"`
+	Rotation            RotationConfig    `yaml:"rotation"`
+	Multiline           MultilineConfig   `yaml:"multiline"`
+	Normalize           NormalizeConfig   `yaml:"normalize"`
+	DiscoverIntervalSec uint              `yaml:"discoverInterval"`
+	Filters             []string          `yaml:"filters"`
+	Selector            map[string]string `yaml:"selector"`
+	JournaldConfig      `yaml:",inline"`
+	SyslogConfig        `yaml:",inline"`
+	ExecConfig          `yaml:",inline"`
 }
 
 type NotificationConfig struct {
 	Name           string `yaml:"name"`
 	Type           string `yaml:"type"`
+	TemplateConfig `yaml:",inline"`
 	MailConfig     `yaml:",inline"`
 	TelegramConfig `yaml:",inline"`
+	WebhookConfig  `yaml:",inline"`
 }
 
 type Config struct {
 	Hostname      string               `yaml:"hostname"`
+	Grok          GrokConfig           `yaml:"grok"`
 	Notifications []NotificationConfig `yaml:"notifications"`
 	Filters       []FilterConfig       `yaml:"filters"`
 	Files         []FileConfig         `yaml:"files"`
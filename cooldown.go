@@ -0,0 +1,89 @@
+package main
+
+import (
+	"time"
+)
+
+// cooldownState is the last sent message of the filter, persisted by the processor.
+// The identical messages are suppressed within the cooldown period
+type cooldownState struct {
+	Sent       time.Time         `json:"sent"`
+	Text       string            `json:"text"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	Suppressed int               `json:"suppressed,omitempty"`
+	// the first suppressed message time
+	Since time.Time `json:"since,omitempty"`
+	// the last suppressed message time
+	Last time.Time `json:"last,omitempty"`
+}
+
+// applyCooldown suppresses the messages identical to the message sent within the cooldown period.
+// The suppressed count is rolled into the next identical message, or into the message
+// sent when the cooldown period expires. The alert messages are not suppressed
+func (p *Processor) applyCooldown(filter *Filter, messages []pendingMessage, now time.Time) []pendingMessage {
+	if p.state.Cooldowns == nil {
+		p.state.Cooldowns = make(map[string]*cooldownState)
+	}
+
+	result := messages[:0]
+
+	for _, pending := range messages {
+		if pending.msg.AlertID != "" {
+			result = append(result, pending)
+			continue
+		}
+
+		key := alertKey(filter.Name, pending.msg.cooldownKey())
+		state, ok := p.state.Cooldowns[key]
+
+		if ok && now.Sub(state.Sent) < filter.Cooldown {
+			if state.Suppressed == 0 {
+				state.Since = now
+			}
+			state.Suppressed += pending.msg.Count
+			state.Last = now
+			p.stateChanged = true
+			continue
+		}
+
+		if ok && state.Suppressed > 0 {
+			pending.msg.Suppressed = state.Suppressed
+			pending.msg.SuppressedSince = state.Since
+		}
+
+		p.state.Cooldowns[key] = &cooldownState{Sent: now, Text: pending.msg.Text, Fields: pending.msg.Fields}
+		p.stateChanged = true
+
+		result = append(result, pending)
+	}
+
+	// the suppressed messages are sent when the cooldown period expires
+	for key, state := range p.state.Cooldowns {
+		if _, ok := alertGroupKey(key, filter.Name); !ok || now.Sub(state.Sent) < filter.Cooldown {
+			continue
+		}
+
+		p.stateChanged = true
+
+		if state.Suppressed == 0 {
+			delete(p.state.Cooldowns, key)
+			continue
+		}
+
+		result = append(result, pendingMessage{msg: Message{
+			FileName:  p.fileName,
+			FilePath:  p.filePath,
+			Text:      state.Text,
+			Count:     state.Suppressed,
+			FirstSeen: state.Since,
+			LastSeen:  state.Last,
+			Fields:    state.Fields,
+			Filter:    filter,
+		}})
+
+		// the sent message starts the new cooldown period
+		p.state.Cooldowns[key] = &cooldownState{Sent: now, Text: state.Text, Fields: state.Fields}
+	}
+
+	return result
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessorCooldown(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{
+		Name:          "errors",
+		Pattern:       `ERROR`,
+		CooldownSec:   60,
+		Message:       "%text",
+		Notifications: []string{"test"},
+	}, "host", []Notifier{&testNotifier{}}, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := FileConfig{Name: "cooldown_test", Path: "/tmp/cooldown_test", Filters: []string{"errors"}}
+
+	processor, err := NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	key := alertKey("errors", "ERROR disk full")
+
+	messages := processor.processLines([]string{"ERROR disk full", "ERROR disk full"})
+	if len(messages) != 1 || messages[0].Count != 2 || messages[0].Suppressed != 0 {
+		t.Fatalf("expected first message, got %+v", messages)
+	}
+
+	// the identical messages are suppressed, the other messages are sent
+	messages = processor.processLines([]string{"ERROR disk full", "ERROR disk full", "ERROR disk full", "ERROR no route"})
+	if len(messages) != 1 || messages[0].Text != "ERROR no route" {
+		t.Fatalf("expected other message only, got %+v", messages)
+	}
+
+	if state := processor.state.Cooldowns[key]; state == nil || state.Suppressed != 3 {
+		t.Fatalf("unexpected cooldown state: %+v", state)
+	}
+
+	// the suppressed count is rolled into the next message after the cooldown
+	processor.state.Cooldowns[key].Sent = time.Now().Add(-time.Minute)
+
+	messages = processor.processLines([]string{"ERROR disk full"})
+	if len(messages) != 1 || messages[0].Count != 1 || messages[0].Suppressed != 3 {
+		t.Fatalf("expected message with suppressed count, got %+v", messages)
+	}
+
+	msg := messages[0]
+	if err := msg.Render("test", Templates{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(msg.Text, "… and 3 more since "+msg.SuppressedSince.Format("15:04")) {
+		t.Errorf("unexpected message text: %q", msg.Text)
+	}
+
+	// the suppressed messages are sent when the cooldown expires
+	processor.processLines([]string{"ERROR disk full", "ERROR disk full"})
+	processor.state.Cooldowns[key].Sent = time.Now().Add(-time.Minute)
+
+	messages = processor.processLines(nil)
+	if len(messages) != 1 || messages[0].Text != "ERROR disk full" || messages[0].Count != 2 {
+		t.Fatalf("expected suppressed messages summary, got %+v", messages)
+	}
+
+	if err := processor.sendMessages(context.Background(), messages); err != nil {
+		t.Fatal(err)
+	}
+
+	// the state is restored after restart
+	processor, err = NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := processor.processLines([]string{"ERROR disk full"}); len(messages) != 0 {
+		t.Fatalf("unexpected messages within the cooldown: %+v", messages)
+	}
+}
+
+func TestProcessorRepeatInterval(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{
+		Name:              "timeouts",
+		Pattern:           `timeout`,
+		Threshold:         ThresholdConfig{Count: 2, WindowSec: 60},
+		RepeatIntervalSec: 300,
+		Notifications:     []string{"test"},
+	}, "host", []Notifier{&testNotifier{}}, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := FileConfig{Name: "repeat_test", Path: "/tmp/repeat_test", Filters: []string{"timeouts"}}
+
+	processor, err := NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	messages := processor.processLines([]string{"timeout", "timeout"})
+	if len(messages) != 1 || messages[0].AlertID == "" {
+		t.Fatalf("expected firing message, got %+v", messages)
+	}
+
+	firing := messages[0]
+
+	if err := processor.sendMessages(context.Background(), messages); err != nil {
+		t.Fatal(err)
+	}
+
+	// the alert is not repeated within the repeat interval
+	if messages := processor.processLines([]string{"timeout", "timeout"}); len(messages) != 0 {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+
+	processor.state.Alerts[alertKey("timeouts", "")].Notified = time.Now().Add(-5 * time.Minute)
+
+	messages = processor.processLines([]string{"timeout", "timeout"})
+	if len(messages) != 1 || messages[0].AlertID != firing.AlertID || messages[0].Resolved || messages[0].Repeat != 1 {
+		t.Fatalf("expected repeated firing message, got %+v", messages)
+	}
+
+	if err := processor.sendMessages(context.Background(), messages); err != nil {
+		t.Fatal(err)
+	}
+
+	// the repeated message doesn't replace the first firing message reference
+	if alert := processor.state.Alerts[alertKey("timeouts", "")]; alert.Refs["test"] != "ref-1" || alert.Repeats != 1 {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+}
+
+func TestProcessorCooldownNotSent(t *testing.T) {
+	notifier := &testNotifier{err: errors.New("connection refused")}
+
+	filter, err := NewFilter(FilterConfig{
+		Name:          "errors",
+		Pattern:       `ERROR`,
+		CooldownSec:   60,
+		Notifications: []string{"test"},
+	}, "host", []Notifier{notifier}, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := FileConfig{Name: "cooldown_not_sent_test", Path: "/tmp/cooldown_not_sent_test", Filters: []string{"errors"}}
+
+	processor, err := NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	messages := processor.processLines([]string{"ERROR disk full"})
+	if err := processor.sendMessages(context.Background(), messages); err == nil {
+		t.Fatal("expected send error")
+	}
+
+	// the not sent message doesn't start the cooldown
+	if messages := processor.processLines([]string{"ERROR disk full"}); len(messages) != 1 {
+		t.Fatalf("expected message, got %+v", messages)
+	}
+}
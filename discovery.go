@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Discoverer periodically searches for files matching the glob pattern
+// and runs a separate Watcher for every found file
+type Discoverer struct {
+	pattern          string
+	discoverInterval time.Duration
+	watchers         map[string]*discoveredWatcher
+	rotation         RotationConfig
+	// newWatcher creates the watcher of the found file,
+	// the file is skipped if both watcher and error are nil
+	newWatcher func(path string) (*Watcher, error)
+}
+
+type discoveredWatcher struct {
+	watcher *Watcher
+	cancel  context.CancelFunc
+	done    chan struct{}
+	// the file is not found by the last discovery
+	missing bool
+}
+
+func NewDiscoverer(cfg FileConfig, filters []*Filter) (*Discoverer, error) {
+	return newDiscoverer(cfg, cfg.Path, func(path string) (*Watcher, error) {
+		watcherCfg := cfg
+		watcherCfg.Path = path
+		return NewWatcher(watcherCfg, filters)
+	})
+}
+
+func newDiscoverer(cfg FileConfig, pattern string, newWatcher func(path string) (*Watcher, error)) (*Discoverer, error) {
+	if _, err := globFiles(pattern); err != nil {
+		return nil, fmt.Errorf("LogFile %s glob pattern error: %v", pattern, err)
+	}
+
+	intervalSec := cfg.DiscoverIntervalSec
+	if intervalSec == 0 {
+		intervalSec = cfg.IntervalSec
+	}
+
+	return &Discoverer{
+		pattern:          pattern,
+		discoverInterval: time.Second * time.Duration(intervalSec),
+		watchers:         make(map[string]*discoveredWatcher),
+		rotation:         cfg.Rotation,
+		newWatcher:       newWatcher,
+	}, nil
+}
+
+func (d *Discoverer) watch(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	log.Printf("[INFO] starting discovery of log files: %s", d.pattern)
+
+	d.discover(ctx, wg)
+
+	ticker := time.NewTicker(d.discoverInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, dw := range d.watchers {
+				<-dw.done
+			}
+			return
+		case <-ticker.C:
+			d.discover(ctx, wg)
+		}
+	}
+}
+
+// discover starts watchers for new files and retires watchers
+// for files which don't match the pattern anymore.
+// The file must be missing on two discoveries in a row to be retired,
+// so a file briefly missing during the rotation keeps its state
+func (d *Discoverer) discover(ctx context.Context, wg *sync.WaitGroup) {
+	paths, err := globFiles(d.pattern)
+	if err != nil {
+		log.Printf("[ERROR] discovery error: %v pattern: %s", err, d.pattern)
+		return
+	}
+
+	paths = d.excludeRotated(paths)
+
+	found := make(map[string]struct{}, len(paths))
+
+	for _, path := range paths {
+		found[path] = struct{}{}
+
+		if dw, ok := d.watchers[path]; ok {
+			dw.missing = false
+			continue
+		}
+
+		watcher, err := d.newWatcher(path)
+		if err != nil {
+			log.Printf("[ERROR] NewWatcher error: %v", err)
+			continue
+		}
+
+		if watcher == nil {
+			continue
+		}
+
+		watcherCtx, cancel := context.WithCancel(ctx)
+		dw := &discoveredWatcher{watcher: watcher, cancel: cancel, done: make(chan struct{})}
+		d.watchers[path] = dw
+
+		wg.Add(1)
+		go func() {
+			defer close(dw.done)
+			dw.watcher.watch(watcherCtx, wg)
+		}()
+	}
+
+	for path, dw := range d.watchers {
+		if _, ok := found[path]; ok {
+			continue
+		}
+
+		if !dw.missing {
+			dw.missing = true
+			continue
+		}
+
+		log.Printf("[INFO] log file %s disappeared, stopping monitoring", path)
+
+		dw.cancel()
+		<-dw.done
+		delete(d.watchers, path)
+
+		if err := dw.watcher.removeState(); err != nil {
+			log.Printf("[ERROR] state remove error: %v log file: %s", err, path)
+		}
+	}
+}
+
+// excludeRotated removes the rotated files of the other matched files,
+// they are read by the watcher of the log file, e.g. app.log.1 and app.log.2.gz of app.log.
+// The files rotated of each other (e.g. by the glob scheme) are kept
+func (d *Discoverer) excludeRotated(paths []string) []string {
+	rotations := make([]*Rotation, len(paths))
+	for i, path := range paths {
+		// the rotation config error is logged by the watcher
+		rotations[i], _ = NewRotation(d.rotation, path)
+	}
+
+	isRotated := func(i, j int) bool {
+		return rotations[i] != nil && rotations[i].isRotated(paths[i], paths[j])
+	}
+
+	result := make([]string, 0, len(paths))
+
+	for j, path := range paths {
+		rotated := false
+
+		for i := range paths {
+			if i != j && isRotated(i, j) && !isRotated(j, i) {
+				rotated = true
+				break
+			}
+		}
+
+		if !rotated {
+			result = append(result, path)
+		}
+	}
+
+	return result
+}
+
+func isGlobPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// globFiles returns sorted paths of regular files matching the pattern.
+// In addition to the filepath.Match syntax the "**" path segment
+// matches any number of nested directories
+func globFiles(pattern string) ([]string, error) {
+	pattern = filepath.Clean(pattern)
+
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var (
+		matches []string
+		err     error
+	)
+
+	if !strings.Contains(pattern, "**") {
+		matches, err = filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err = filepath.WalkDir(globRoot(pattern), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				// unreadable directories are skipped
+				return nil
+			}
+			if matchGlob(pattern, path) {
+				matches = append(matches, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	paths := make([]string, 0, len(matches))
+
+	for _, path := range matches {
+		fInfo, err := os.Stat(path)
+		if err != nil || !fInfo.Mode().IsRegular() {
+			continue
+		}
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// globRoot returns the longest directory prefix of the pattern without meta characters
+func globRoot(pattern string) string {
+	segments := strings.Split(pattern, string(filepath.Separator))
+
+	for i, segment := range segments {
+		if isGlobPattern(segment) {
+			root := strings.Join(segments[:i], string(filepath.Separator))
+			if root == "" && filepath.IsAbs(pattern) {
+				return string(filepath.Separator)
+			}
+			if root == "" {
+				return "."
+			}
+			return root
+		}
+	}
+
+	return pattern
+}
+
+// matchGlob reports whether the path matches the pattern with "**" segments support
+func matchGlob(pattern, path string) bool {
+	return matchSegments(
+		strings.Split(pattern, string(filepath.Separator)),
+		strings.Split(filepath.Clean(path), string(filepath.Separator)),
+	)
+}
+
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(path) == 0 {
+			return false
+		}
+
+		ok, err := filepath.Match(pattern[0], path[0])
+		if err != nil || !ok {
+			return false
+		}
+
+		pattern, path = pattern[1:], path[1:]
+	}
+
+	return len(path) == 0
+}
+
+// newSelector compiles patterns of the discovered log source fields
+func newSelector(cfg map[string]string) (map[string]*regexp.Regexp, error) {
+	selector := make(map[string]*regexp.Regexp, len(cfg))
+
+	for field, pattern := range cfg {
+		reg, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("selector field %s pattern compile error: %v", field, err)
+		}
+		selector[field] = reg
+	}
+
+	return selector, nil
+}
+
+// matchSelector reports whether all the selector patterns match the fields
+func matchSelector(selector map[string]*regexp.Regexp, fields map[string]string) bool {
+	for field, reg := range selector {
+		value, ok := fields[field]
+		if !ok || !reg.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"1. Simple match", "/var/log/*.log", "/var/log/app.log", true},
+		{"2. Simple mismatch", "/var/log/*.log", "/var/log/app.log.1", false},
+		{"3. Nested dir without **", "/var/log/*.log", "/var/log/app/app.log", false},
+		{"4. ** matches no dirs", "/var/log/**/*.log", "/var/log/app.log", true},
+		{"5. ** matches one dir", "/var/log/**/*.log", "/var/log/app/app.log", true},
+		{"6. ** matches many dirs", "/var/log/**/*.log", "/var/log/a/b/c/app.log", true},
+		{"7. ** in the middle", "/var/log/**/worker-?/*.log", "/var/log/a/worker-1/out.log", true},
+		{"8. ** in the middle mismatch", "/var/log/**/worker-?/*.log", "/var/log/a/worker-10/out.log", false},
+		{"9. Trailing **", "/var/log/**", "/var/log/a/b", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if matched := matchGlob(tt.pattern, tt.path); matched != tt.expected {
+				t.Errorf("Expected %v for pattern '%s' and path '%s', received %v", tt.expected, tt.pattern, tt.path, matched)
+			}
+		})
+	}
+}
+
+func TestGlobFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, path := range []string{"a.log", "b.txt", "w1/c.log", "w1/w2/d.log"} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		createFileWithData(path, []byte("data\n"))
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "dir.log"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		pattern  string
+		expected []string
+	}{
+		{"1. Single dir", "*.log", []string{"a.log"}},
+		{"2. Recursive", "**/*.log", []string{"a.log", "w1/c.log", "w1/w2/d.log"}},
+		{"3. Recursive subdir", "w1/**/*.log", []string{"w1/c.log", "w1/w2/d.log"}},
+		{"4. No matches", "*.gz", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := globFiles(filepath.Join(dir, tt.pattern))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := make([]string, 0, len(tt.expected))
+			for _, path := range tt.expected {
+				expected = append(expected, filepath.Join(dir, path))
+			}
+
+			if !reflect.DeepEqual(paths, expected) {
+				t.Errorf("Expected paths %v, received %v", expected, paths)
+			}
+		})
+	}
+
+	if _, err := globFiles(filepath.Join(dir, "[.log")); err == nil {
+		t.Error("Expected bad pattern error")
+	}
+}
+
+func TestDiscoverMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	createFileWithData(path, []byte("data\n"))
+
+	d, err := newDiscoverer(FileConfig{IntervalSec: 3600}, filepath.Join(dir, "*.log"), func(path string) (*Watcher, error) {
+		return NewWatcher(FileConfig{Path: path, IntervalSec: 3600, ReadBufferSize: "1kb"}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	d.discover(ctx, &wg)
+
+	dw, ok := d.watchers[path]
+	if !ok {
+		t.Fatal("expected watcher")
+	}
+	defer dw.watcher.removeState()
+
+	// the state is saved by the first check of the watcher
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(dw.watcher.stateFilePath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the file missing once, e.g. during the rotation, keeps the watcher
+	os.Remove(path)
+	d.discover(ctx, &wg)
+
+	createFileWithData(path, []byte("data\n"))
+	d.discover(ctx, &wg)
+
+	os.Remove(path)
+	d.discover(ctx, &wg)
+
+	if _, ok := d.watchers[path]; !ok {
+		t.Fatal("expected watcher kept")
+	}
+
+	if _, err := os.Stat(dw.watcher.stateFilePath); err != nil {
+		t.Fatalf("expected state kept, got %v", err)
+	}
+
+	// the file missing twice in a row retires the watcher
+	d.discover(ctx, &wg)
+
+	if _, ok := d.watchers[path]; ok {
+		t.Fatal("expected watcher retired")
+	}
+
+	if _, err := os.Stat(dw.watcher.stateFilePath); !os.IsNotExist(err) {
+		t.Errorf("expected state removed, got %v", err)
+	}
+}
+
+func TestDiscoverExcludeRotated(t *testing.T) {
+	tests := []struct {
+		name     string
+		rotation RotationConfig
+		pattern  string
+		files    []string
+		expected []string
+	}{
+		{
+			"1. Numeric",
+			RotationConfig{},
+			"*",
+			[]string{"app.log", "app.log.1", "app.log.2.gz", "app.log.10", "app.log.bak", "db.log"},
+			[]string{"app.log", "app.log.bak", "db.log"},
+		},
+		{
+			"2. Dateext",
+			RotationConfig{Scheme: RotationDateExt},
+			"*",
+			[]string{"app.log", "app.log-20261016.gz", "app.log-20261017", "db.log"},
+			[]string{"app.log", "db.log"},
+		},
+		{
+			"3. Glob",
+			RotationConfig{Scheme: RotationGlob, Pattern: "app.*.log"},
+			"*.log",
+			[]string{"app.log", "app.2026-10-16.log", "app.2026-10-17.log", "db.log"},
+			[]string{"app.log", "db.log"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, file := range tt.files {
+				createFileWithData(filepath.Join(dir, file), []byte("data\n"))
+			}
+
+			rotation := tt.rotation
+			if rotation.Pattern != "" {
+				rotation.Pattern = filepath.Join(dir, rotation.Pattern)
+			}
+
+			d, err := newDiscoverer(FileConfig{Rotation: rotation}, filepath.Join(dir, tt.pattern), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			paths, err := globFiles(d.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := make([]string, 0, len(tt.expected))
+			for _, file := range tt.expected {
+				expected = append(expected, filepath.Join(dir, file))
+			}
+
+			if paths = d.excludeRotated(paths); !reflect.DeepEqual(paths, expected) {
+				t.Errorf("Expected paths %v, received %v", expected, paths)
+			}
+		})
+	}
+}
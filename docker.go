@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const SourceTypeDocker = "docker"
+
+const dockerContainersPath = "/var/lib/docker/containers"
+
+// dockerContainerConfig is a part of the container config.v2.json
+type dockerContainerConfig struct {
+	ID     string
+	Name   string
+	Config struct {
+		Image  string
+		Labels map[string]string
+	}
+}
+
+// dockerLogEntry is a line of the json-file logging driver log
+type dockerLogEntry struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time"`
+}
+
+// dockerDecoder unwraps json-file logging driver lines and joins partial lines
+// of every stream, the stdout and stderr lines may be interleaved
+type dockerDecoder struct{}
+
+// NewDockerDiscoverer discovers container logs in the containers directory (cfg.Path).
+// Container fields: container_id, container_name, image, label.<name>
+func NewDockerDiscoverer(cfg FileConfig, filters []*Filter) (*Discoverer, error) {
+	containersPath := cfg.Path
+	if containersPath == "" {
+		containersPath = dockerContainersPath
+	}
+
+	selector, err := newSelector(cfg.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("docker source %s %v", cfg.Name, err)
+	}
+
+	pattern := filepath.Join(containersPath, "*", "*-json.log")
+
+	// the container config errors are logged once per container log,
+	// the container is checked again on the next discovery
+	failed := make(map[string]struct{})
+
+	return newDiscoverer(cfg, pattern, func(path string) (*Watcher, error) {
+		fields, err := dockerContainerFields(filepath.Join(filepath.Dir(path), "config.v2.json"))
+		if err != nil {
+			if _, ok := failed[path]; !ok {
+				failed[path] = struct{}{}
+				log.Printf("[ERROR] docker source %s container config error: %v", cfg.Name, err)
+			}
+			return nil, nil
+		}
+
+		delete(failed, path)
+
+		if !matchSelector(selector, fields) {
+			return nil, nil
+		}
+
+		watcherCfg := cfg
+		watcherCfg.Path = path
+
+		watcher, err := NewWatcher(watcherCfg, filters)
+		if err != nil {
+			return nil, err
+		}
+
+		watcher.decoder = &dockerDecoder{}
+		watcher.fields = fields
+
+		return watcher, nil
+	})
+}
+
+func dockerContainerFields(configPath string) (map[string]string, error) {
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg dockerContainerConfig
+
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("container config %s unmarshal error: %v", configPath, err)
+	}
+
+	containerID := cfg.ID
+	if len(containerID) > 12 {
+		containerID = containerID[:12]
+	}
+
+	fields := map[string]string{
+		"container_id":   containerID,
+		"container_name": strings.TrimPrefix(cfg.Name, "/"),
+		"image":          cfg.Config.Image,
+	}
+
+	for name, value := range cfg.Config.Labels {
+		fields["label."+name] = value
+	}
+
+	return fields, nil
+}
+
+func (d *dockerDecoder) decode(line string, partial map[string]string) (Record, bool) {
+	if line == "" {
+		return Record{}, false
+	}
+
+	var entry dockerLogEntry
+
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return Record{Text: line}, true
+	}
+
+	// the lines longer than 16Kb are split by docker, only the last part ends with newline
+	if !strings.HasSuffix(entry.Log, "\n") {
+		partial[entry.Stream] += entry.Log
+		return Record{}, false
+	}
+
+	text := partial[entry.Stream] + strings.TrimRight(entry.Log, "\r\n")
+	delete(partial, entry.Stream)
+
+	return Record{
+		Text: text,
+		Fields: map[string]string{
+			"stream": entry.Stream,
+			"time":   entry.Time,
+		},
+	}, true
+}
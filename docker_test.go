@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDockerDecoder(t *testing.T) {
+	lines := []string{
+		`{"log":"first line\n","stream":"stdout","time":"2023-10-12T10:15:25.1Z"}`,
+		`{"log":"long line part 1, ","stream":"stderr","time":"2023-10-12T10:15:26.1Z"}`,
+		`{"log":"stdout part 1, ","stream":"stdout","time":"2023-10-12T10:15:26.1Z"}`,
+		`{"log":"part 2\n","stream":"stderr","time":"2023-10-12T10:15:26.2Z"}`,
+		`{"log":"stdout part 2\n","stream":"stdout","time":"2023-10-12T10:15:26.3Z"}`,
+		`not json line`,
+		``,
+	}
+
+	expected := []Record{
+		{
+			Text:   "first line",
+			Fields: map[string]string{"stream": "stdout", "time": "2023-10-12T10:15:25.1Z"},
+		},
+		{
+			Text:   "long line part 1, part 2",
+			Fields: map[string]string{"stream": "stderr", "time": "2023-10-12T10:15:26.2Z"},
+		},
+		{
+			Text:   "stdout part 1, stdout part 2",
+			Fields: map[string]string{"stream": "stdout", "time": "2023-10-12T10:15:26.3Z"},
+		},
+		{
+			Text: "not json line",
+		},
+	}
+
+	decoder := &dockerDecoder{}
+
+	partial := make(map[string]string)
+
+	var records []Record
+	for _, line := range lines {
+		if record, ok := decoder.decode(line, partial); ok {
+			records = append(records, record)
+		}
+	}
+
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Expected records %+v, received %+v", expected, records)
+	}
+}
+
+func TestDockerContainerFields(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.v2.json")
+	createFileWithData(configPath, []byte(`{
+		"ID": "0123456789abcdef0123",
+		"Name": "/web",
+		"Config": {"Image": "nginx:1.25", "Labels": {"team": "payments"}}
+	}`))
+
+	fields, err := dockerContainerFields(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"container_id":   "0123456789ab",
+		"container_name": "web",
+		"image":          "nginx:1.25",
+		"label.team":     "payments",
+	}
+
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected fields %v, received %v", expected, fields)
+	}
+}
+
+func TestDockerMissingContainerConfig(t *testing.T) {
+	containersPath := t.TempDir()
+	logPath := filepath.Join(containersPath, "0123456789ab", "0123456789ab-json.log")
+
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	createFileWithData(logPath, []byte(`{"log":"line\n","stream":"stdout","time":"2023-10-12T10:15:25.1Z"}`+"\n"))
+
+	d, err := NewDockerDiscoverer(FileConfig{Name: "docker", Path: containersPath, IntervalSec: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+
+	// the error is logged on the first discovery only
+	for i := 0; i < 3; i++ {
+		d.discover(ctx, &wg)
+	}
+
+	if count := strings.Count(buf.String(), "[ERROR]"); count != 1 || len(d.watchers) != 0 {
+		t.Errorf("expected one error, got %d: %s", count, buf.String())
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SourceTypeExec = "exec"
+
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+)
+
+type ExecConfig struct {
+	Command         string            `yaml:"command"`
+	Args            []string          `yaml:"args"`
+	Env             map[string]string `yaml:"env"`
+	Restart         string            `yaml:"restart"`
+	RestartDelaySec uint              `yaml:"restartDelay"`
+}
+
+// Exec runs the command and reads lines of its stdout and stderr.
+// The command exit is reported as the record with the "exit" stream
+type Exec struct {
+	name          string
+	command       string
+	args          []string
+	env           []string
+	restart       string
+	restartDelay  time.Duration
+	checkInterval time.Duration
+	processor     *Processor
+	queue         recordQueue
+}
+
+func NewExec(cfg FileConfig, filters []*Filter) (*Exec, error) {
+	if cfg.Command == "" {
+		return nil, fmt.Errorf("exec source %s command is empty", cfg.Name)
+	}
+
+	e := &Exec{
+		name:          cfg.Name,
+		command:       cfg.Command,
+		args:          cfg.Args,
+		env:           os.Environ(),
+		restart:       cfg.Restart,
+		restartDelay:  time.Second * time.Duration(cfg.RestartDelaySec),
+		checkInterval: time.Second * time.Duration(cfg.IntervalSec),
+		queue:         recordQueue{name: "command " + cfg.Name},
+	}
+
+	switch e.restart {
+	case "":
+		e.restart = RestartAlways
+	case RestartAlways, RestartOnFailure, RestartNever:
+	default:
+		return nil, fmt.Errorf("exec source %s restart policy '%s' is unsupported", cfg.Name, e.restart)
+	}
+
+	if e.restartDelay == 0 {
+		e.restartDelay = e.checkInterval
+	}
+
+	for key, value := range cfg.Env {
+		e.env = append(e.env, key+"="+value)
+	}
+
+	var err error
+
+	e.processor, err = NewProcessor(cfg, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *Exec) watch(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	log.Printf("[INFO] starting command: %s", e.commandLine())
+
+	go e.runLoop(ctx)
+
+	ticker := time.NewTicker(e.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.check(ctx)
+		}
+	}
+}
+
+func (e *Exec) check(ctx context.Context) {
+	records := e.queue.pop()
+
+	messages := e.processor.processRecords(records)
+
+	if err := e.processor.sendMessages(ctx, messages); err != nil {
+		log.Printf("[ERROR] command %s: %v", e.name, err)
+
+		// the records are processed again on the next check
+		e.queue.requeue(records)
+	}
+}
+
+// runLoop runs the command and restarts it according to the restart policy
+func (e *Exec) runLoop(ctx context.Context) {
+	for {
+		exitCode, err := e.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		status := "exit status 0"
+		if err != nil {
+			status = err.Error()
+		}
+
+		log.Printf("[INFO] command %s exited: %s", e.commandLine(), status)
+
+		e.queue.push(Record{
+			Text: fmt.Sprintf("command '%s' exited: %s", e.commandLine(), status),
+			Time: time.Now(),
+			Fields: map[string]string{
+				"stream":    "exit",
+				"exit_code": strconv.Itoa(exitCode),
+			},
+		})
+
+		if e.restart == RestartNever || (e.restart == RestartOnFailure && exitCode == 0) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.restartDelay):
+		}
+	}
+}
+
+// run runs the command until exit and returns its exit code
+func (e *Exec) run(ctx context.Context) (int, error) {
+	cmd := exec.CommandContext(ctx, e.command, e.args...)
+	cmd.Env = e.env
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return -1, err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return -1, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return -1, err
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	go e.readLines(stdout, "stdout", &wg)
+	go e.readLines(stderr, "stderr", &wg)
+
+	// all the output must be read before Wait
+	wg.Wait()
+
+	err = cmd.Wait()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), err
+	}
+
+	if err != nil {
+		return -1, err
+	}
+
+	return 0, nil
+}
+
+func (e *Exec) readLines(r io.Reader, stream string, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			e.queue.push(Record{
+				Text:   strings.TrimRight(line, "\r\n"),
+				Fields: map[string]string{"stream": stream},
+				Time:   time.Now(),
+			})
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (e *Exec) commandLine() string {
+	return strings.Join(append([]string{e.command}, e.args...), " ")
+}
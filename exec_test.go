@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestExecRun(t *testing.T) {
+	cfg := FileConfig{
+		Name:        "test",
+		IntervalSec: 1,
+		ExecConfig: ExecConfig{
+			Command: "sh",
+			Args:    []string{"-c", "echo out line; echo err line >&2; echo $LOGALERT_TEST; exit 3"},
+			Env:     map[string]string{"LOGALERT_TEST": "env line"},
+			Restart: RestartNever,
+		},
+	}
+
+	e, err := NewExec(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// returns after the command exit due to the restart policy
+	e.runLoop(context.Background())
+
+	var received []string
+	for _, record := range e.queue.pop() {
+		received = append(received, record.Fields["stream"]+": "+record.Text)
+
+		if record.Fields["stream"] == "exit" && record.Fields["exit_code"] != "3" {
+			t.Errorf("Expected exit code 3, received %s", record.Fields["exit_code"])
+		}
+	}
+	sort.Strings(received)
+
+	expected := []string{
+		"exit: command 'sh -c echo out line; echo err line >&2; echo $LOGALERT_TEST; exit 3' exited: exit status 3",
+		"stderr: err line",
+		"stdout: env line",
+		"stdout: out line",
+	}
+
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Expected records %q, received %q", expected, received)
+	}
+}
@@ -4,42 +4,131 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 )
 
 type Filter struct {
-	Name          string
-	LineReg       *regexp.Regexp
-	ExceptRegs    []*regexp.Regexp
-	TextFormat    string
-	SubjectFormat string
-	Notifiers     []Notifier
+	Name              string
+	LineReg           *regexp.Regexp
+	CaptureFields     map[string]string
+	ExceptRegs        []*regexp.Regexp
+	FieldRegs         map[string]*regexp.Regexp
+	Conditions        []*Condition
+	MatchTree         *matchNode
+	GroupBy           []string
+	ContextBefore     int
+	ContextAfter      int
+	Threshold         *Threshold
+	Absence           *Absence
+	Cooldown          time.Duration
+	RepeatInterval    time.Duration
+	Hostname          string
+	Templates         Templates
+	NotifierTemplates map[string]Templates
+	Notifiers         []Notifier
 }
 
-func NewFilter(cfg FilterConfig, hostname string, notifiers []Notifier) (*Filter, error) {
-	lineReg, err := regexp.Compile(cfg.Pattern)
+func NewFilter(cfg FilterConfig, hostname string, notifiers []Notifier, grok *Grok) (*Filter, error) {
+	lineReg, captureFields, err := grok.Compile(cfg.Pattern)
 	if err != nil {
 		return nil, fmt.Errorf("LogFile filter %s pattern compile error: %v", cfg.Name, err)
 	}
 
+	// regexp named groups are fields too, e.g. (?P<user>\w+)
+	for _, group := range lineReg.SubexpNames() {
+		if _, ok := captureFields[group]; !ok && group != "" {
+			captureFields[group] = group
+		}
+	}
+
 	exceptRegs := make([]*regexp.Regexp, 0, len(cfg.Exceptions))
 
 	for _, exStr := range cfg.Exceptions {
-		exReg, err := regexp.Compile(exStr)
+		exReg, _, err := grok.Compile(exStr)
 		if err != nil {
 			return nil, fmt.Errorf("LogFile filter %s exception pattern %s compile error: %v", cfg.Name, exStr, err)
 		}
 		exceptRegs = append(exceptRegs, exReg)
 	}
 
+	fieldRegs := make(map[string]*regexp.Regexp, len(cfg.Fields))
+
+	for field, fieldStr := range cfg.Fields {
+		fieldReg, err := regexp.Compile(fieldStr)
+		if err != nil {
+			return nil, fmt.Errorf("LogFile filter %s field %s pattern compile error: %v", cfg.Name, field, err)
+		}
+		fieldRegs[field] = fieldReg
+	}
+
+	conditions := make([]*Condition, 0, len(cfg.Conditions))
+
+	for _, expr := range cfg.Conditions {
+		condition, err := NewCondition(expr)
+		if err != nil {
+			return nil, fmt.Errorf("LogFile filter %s %v", cfg.Name, err)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	var matchTree *matchNode
+
+	if cfg.Match != nil {
+		matchTree, err = newMatchNode(*cfg.Match, grok)
+		if err != nil {
+			return nil, fmt.Errorf("LogFile filter %s %v", cfg.Name, err)
+		}
+	}
+
+	templates, err := NewTemplates(cfg.Name, TemplateConfig{Subject: cfg.Subject, Message: cfg.Message})
+	if err != nil {
+		return nil, fmt.Errorf("LogFile filter %s %v", cfg.Name, err)
+	}
+
+	threshold, err := NewThreshold(cfg.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("LogFile filter %s %v", cfg.Name, err)
+	}
+
+	absence, err := NewAbsence(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("LogFile filter %s %v", cfg.Name, err)
+	}
+
 	cfg.Notifications = removeDuplicates(cfg.Notifications)
 
+	notifierTemplates := make(map[string]Templates, len(cfg.Templates))
+
+	for notifName, templateCfg := range cfg.Templates {
+		if !containsString(cfg.Notifications, notifName) {
+			return nil, fmt.Errorf("LogFile filter %s template notification %s is not in the filter notifications", cfg.Name, notifName)
+		}
+
+		notifierTemplates[notifName], err = NewTemplates(cfg.Name, templateCfg)
+		if err != nil {
+			return nil, fmt.Errorf("LogFile filter %s notification %s %v", cfg.Name, notifName, err)
+		}
+	}
+
 	f := &Filter{
-		Name:          cfg.Name,
-		LineReg:       lineReg,
-		ExceptRegs:    exceptRegs,
-		TextFormat:    strings.Replace(cfg.Message, "%hostname", hostname, -1),
-		SubjectFormat: strings.Replace(cfg.Subject, "%hostname", hostname, -1),
-		Notifiers:     make([]Notifier, 0, len(cfg.Notifications)),
+		Name:              cfg.Name,
+		LineReg:           lineReg,
+		CaptureFields:     captureFields,
+		GroupBy:           cfg.GroupBy,
+		ContextBefore:     int(cfg.ContextBefore),
+		ContextAfter:      int(cfg.ContextAfter),
+		Threshold:         threshold,
+		Absence:           absence,
+		Cooldown:          time.Second * time.Duration(cfg.CooldownSec),
+		RepeatInterval:    time.Second * time.Duration(cfg.RepeatIntervalSec),
+		ExceptRegs:        exceptRegs,
+		FieldRegs:         fieldRegs,
+		Conditions:        conditions,
+		MatchTree:         matchTree,
+		Hostname:          hostname,
+		Templates:         templates,
+		NotifierTemplates: notifierTemplates,
+		Notifiers:         make([]Notifier, 0, len(cfg.Notifications)),
 	}
 
 	for _, notifName := range cfg.Notifications {
@@ -53,16 +142,76 @@ func NewFilter(cfg FilterConfig, hostname string, notifiers []Notifier) (*Filter
 	return f, nil
 }
 
-func (f *Filter) Match(str string) bool {
-	if !f.LineReg.MatchString(str) {
-		return false
+// Match returns the record with the fields captured by the pattern
+// and reports whether the record matches the filter
+func (f *Filter) Match(record Record) (Record, bool) {
+	if len(f.CaptureFields) == 0 {
+		if !f.LineReg.MatchString(record.Text) {
+			return record, false
+		}
+	} else {
+		submatches := f.LineReg.FindStringSubmatchIndex(record.Text)
+		if submatches == nil {
+			return record, false
+		}
+		record = f.extractFields(record, submatches)
 	}
 
 	for _, exReg := range f.ExceptRegs {
-		if exReg.MatchString(str) {
-			return false
+		if exReg.MatchString(record.Text) {
+			return record, false
 		}
 	}
 
-	return true
+	for field, fieldReg := range f.FieldRegs {
+		value, ok := record.Fields[field]
+		if !ok || !fieldReg.MatchString(value) {
+			return record, false
+		}
+	}
+
+	for _, condition := range f.Conditions {
+		if !condition.Match(record.Fields) {
+			return record, false
+		}
+	}
+
+	if f.MatchTree != nil && !f.MatchTree.match(record) {
+		return record, false
+	}
+
+	return record, true
+}
+
+// extractFields adds the pattern captures to the record fields,
+// the captures of the optional groups that didn't participate in the match are skipped
+func (f *Filter) extractFields(record Record, submatches []int) Record {
+	fields := make(map[string]string, len(record.Fields)+len(f.CaptureFields))
+
+	for name, value := range record.Fields {
+		fields[name] = value
+	}
+
+	for i, group := range f.LineReg.SubexpNames() {
+		field, ok := f.CaptureFields[group]
+		if !ok || submatches[2*i] < 0 {
+			continue
+		}
+		fields[field] = record.Text[submatches[2*i]:submatches[2*i+1]]
+	}
+
+	record.Fields = fields
+
+	return record
+}
+
+// groupKey returns the aggregation key of the record built from the group by fields
+func (f *Filter) groupKey(record Record) string {
+	values := make([]string, len(f.GroupBy))
+
+	for i, field := range f.GroupBy {
+		values[i] = record.Fields[field]
+	}
+
+	return strings.Join(values, "\x00")
 }
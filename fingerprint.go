@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+)
+
+// fingerprintSize is the maximum size of the file head used for the file identification
+const fingerprintSize = 1024
+
+// readFingerprint returns the hash of the first size bytes of the reader.
+// The second value is false if the reader has less than size bytes
+func readFingerprint(r io.Reader, size int64) (string, bool) {
+	if size <= 0 {
+		return "", false
+	}
+
+	h := md5.New()
+
+	n, err := io.CopyN(h, r, size)
+	if err != nil || n != size {
+		return "", false
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), true
+}
+
+// fileFingerprint returns the hash of the first size bytes of the decompressed file
+func fileFingerprint(path string, size int64) (string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	reader, err := decompress(file, path)
+	if err != nil {
+		return "", false
+	}
+	defer reader.Close()
+
+	return readFingerprint(reader, size)
+}
+
+// matchFingerprint reports whether the file head matches the state fingerprint
+func matchFingerprint(path string, state State) bool {
+	if state.Fingerprint == "" {
+		return false
+	}
+
+	fingerprint, ok := fileFingerprint(path, state.FingerprintSize)
+
+	return ok && fingerprint == state.Fingerprint
+}
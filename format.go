@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	FormatPlain  = "plain"
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+func validateFormat(format string) error {
+	switch format {
+	case "", FormatPlain, FormatJSON, FormatLogfmt:
+		return nil
+	}
+	return fmt.Errorf("log format '%s' is unsupported", format)
+}
+
+// parseFields adds the fields parsed from the record text to the record.
+// The fields provided by the log source are not overwritten.
+// The record is returned as is if its text is not in the log format
+func parseFields(format string, record Record) Record {
+	var (
+		fields map[string]string
+		ok     bool
+	)
+
+	switch format {
+	case FormatJSON:
+		fields, ok = parseJSONFields(record.Text)
+	case FormatLogfmt:
+		fields, ok = parseLogfmtFields(record.Text)
+	}
+
+	if !ok {
+		return record
+	}
+
+	for name, value := range record.Fields {
+		fields[name] = value
+	}
+
+	record.Fields = fields
+
+	return record
+}
+
+// parseJSONFields parses the json object, nested objects fields are named by path, e.g. "http.status"
+func parseJSONFields(text string) (map[string]string, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "{") {
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+
+	var object map[string]interface{}
+
+	if err := decoder.Decode(&object); err != nil {
+		return nil, false
+	}
+
+	fields := make(map[string]string, len(object))
+	flattenJSON("", object, fields)
+
+	return fields, true
+}
+
+func flattenJSON(prefix string, object map[string]interface{}, fields map[string]string) {
+	for key, value := range object {
+		name := prefix + key
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenJSON(name+".", v, fields)
+		case string:
+			fields[name] = v
+		case json.Number:
+			fields[name] = v.String()
+		case bool:
+			fields[name] = fmt.Sprint(v)
+		case nil:
+			fields[name] = ""
+		default:
+			// arrays are kept as json
+			var buf bytes.Buffer
+			encoder := json.NewEncoder(&buf)
+			encoder.SetEscapeHTML(false)
+			encoder.Encode(v)
+			fields[name] = strings.TrimSpace(buf.String())
+		}
+	}
+}
+
+// parseLogfmtFields parses key=value pairs, e.g. level=error msg="db timeout" dur=5.2s.
+// Words without value (e.g. the timestamp before pairs) are skipped,
+// unterminated quoted value lasts until the end of the line.
+// The line without pairs is not in logfmt
+func parseLogfmtFields(text string) (map[string]string, bool) {
+	fields := make(map[string]string)
+
+	for i := 0; i < len(text); {
+		if isLogfmtSpace(text[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(text) && !isLogfmtSpace(text[i]) && text[i] != '=' {
+			i++
+		}
+		key := text[start:i]
+
+		if i == len(text) || text[i] != '=' {
+			continue
+		}
+		i++
+
+		var value string
+
+		if i < len(text) && text[i] == '"' {
+			start = i
+			for i++; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+
+			if i < len(text) {
+				i++
+				unquoted, err := strconv.Unquote(text[start:i])
+				if err != nil {
+					unquoted = text[start+1 : i-1]
+				}
+				value = unquoted
+			} else {
+				value = text[start+1:]
+			}
+		} else {
+			start = i
+			for i < len(text) && !isLogfmtSpace(text[i]) {
+				i++
+			}
+			value = text[start:i]
+		}
+
+		if key == "" || strings.ContainsRune(key, '"') {
+			continue
+		}
+
+		fields[key] = value
+	}
+
+	return fields, len(fields) > 0
+}
+
+func isLogfmtSpace(c byte) bool {
+	return c < 0x80 && unicode.IsSpace(rune(c))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		record   Record
+		expected map[string]string
+	}{
+		{
+			"1. JSON nested objects",
+			FormatJSON,
+			Record{Text: `{"level":"error","msg":"db timeout","http":{"status":503,"method":"GET"},"user":{"id":42}}`},
+			map[string]string{
+				"level":       "error",
+				"msg":         "db timeout",
+				"http.status": "503",
+				"http.method": "GET",
+				"user.id":     "42",
+			},
+		},
+		{
+			"2. JSON values",
+			FormatJSON,
+			Record{Text: `{"ok":false,"err":null,"tags":["a","b"],"dur":0.25}`},
+			map[string]string{
+				"ok":   "false",
+				"err":  "",
+				"tags": `["a","b"]`,
+				"dur":  "0.25",
+			},
+		},
+		{
+			"3. Not JSON line",
+			FormatJSON,
+			Record{Text: "panic: runtime error"},
+			nil,
+		},
+		{
+			"4. Source fields are kept",
+			FormatJSON,
+			Record{Text: `{"stream":"app","level":"warn"}`, Fields: map[string]string{"stream": "stderr"}},
+			map[string]string{
+				"stream": "stderr",
+				"level":  "warn",
+			},
+		},
+		{
+			"5. Logfmt quoted values",
+			FormatLogfmt,
+			Record{Text: `level=error msg="db timeout: \"users\"" dur=5.2s`},
+			map[string]string{
+				"level": "error",
+				"msg":   `db timeout: "users"`,
+				"dur":   "5.2s",
+			},
+		},
+		{
+			"6. Logfmt words without value and empty values",
+			FormatLogfmt,
+			Record{Text: `2023-10-12T10:15:25Z ERROR caller=main.go:42 err= user.id=7`},
+			map[string]string{
+				"caller":  "main.go:42",
+				"err":     "",
+				"user.id": "7",
+			},
+		},
+		{
+			"7. Logfmt unterminated quote",
+			FormatLogfmt,
+			Record{Text: `level=warn msg="connection reset`},
+			map[string]string{
+				"level": "warn",
+				"msg":   "connection reset",
+			},
+		},
+		{
+			"8. Not logfmt line",
+			FormatLogfmt,
+			Record{Text: "\tat com.foo.Bar.baz(Bar.java:42)"},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := parseFields(tt.format, tt.record)
+			if !reflect.DeepEqual(record.Fields, tt.expected) {
+				t.Errorf("got %v, expected %v", record.Fields, tt.expected)
+			}
+			if record.Text != tt.record.Text {
+				t.Errorf("record text changed: %q", record.Text)
+			}
+		})
+	}
+}
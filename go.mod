@@ -4,5 +4,6 @@ go 1.19
 
 require (
 	github.com/go-telegram/bot v0.8.0
+	github.com/klauspost/compress v1.17.4
 	gopkg.in/yaml.v3 v3.0.1
 )
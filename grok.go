@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// GrokConfig defines custom grok patterns in addition to the built-in ones
+type GrokConfig struct {
+	// files with "NAME regexp" lines, empty and "#" lines are skipped
+	PatternFiles []string          `yaml:"patternFiles"`
+	Patterns     map[string]string `yaml:"patterns"`
+}
+
+// grokReg matches %{NAME}, %{NAME:field} and %{NAME:field:type}
+var grokReg = regexp.MustCompile(`%\{(\w+)(?::([\w.@-]+))?(?::\w+)?\}`)
+
+// Grok expands grok-style named patterns to regexps
+type Grok struct {
+	patterns map[string]string
+}
+
+func NewGrok(cfg GrokConfig) (*Grok, error) {
+	g := &Grok{patterns: make(map[string]string, len(grokPatterns))}
+
+	for name, pattern := range grokPatterns {
+		g.patterns[name] = pattern
+	}
+
+	for _, path := range cfg.PatternFiles {
+		if err := g.loadFile(path); err != nil {
+			return nil, fmt.Errorf("grok patterns file %s error: %v", path, err)
+		}
+	}
+
+	for name, pattern := range cfg.Patterns {
+		g.patterns[name] = pattern
+	}
+
+	return g, nil
+}
+
+func (g *Grok) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sep := strings.IndexAny(line, " \t")
+		if sep == -1 {
+			return fmt.Errorf("pattern %s is empty", line)
+		}
+
+		g.patterns[line[:sep]] = strings.TrimSpace(line[sep:])
+	}
+
+	return scanner.Err()
+}
+
+// Compile expands grok patterns and compiles the regexp.
+// Returns the regexp and the field names of its grok captures by group name
+func (g *Grok) Compile(pattern string) (*regexp.Regexp, map[string]string, error) {
+	fields := make(map[string]string)
+
+	expanded, err := g.expand(pattern, fields, map[string]bool{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reg, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reg, fields, nil
+}
+
+// expand replaces grok patterns recursively, the captures get generated group names
+// because field names like "http.status" are not allowed in regexp group names
+func (g *Grok) expand(pattern string, fields map[string]string, parents map[string]bool) (string, error) {
+	var err error
+
+	expanded := grokReg.ReplaceAllStringFunc(pattern, func(s string) string {
+		if err != nil {
+			return s
+		}
+
+		sub := grokReg.FindStringSubmatch(s)
+		name, field := sub[1], sub[2]
+
+		definition, ok := g.patterns[name]
+		if !ok {
+			err = fmt.Errorf("grok pattern %s is not defined", name)
+			return s
+		}
+
+		if parents[name] {
+			err = fmt.Errorf("grok pattern %s is recursive", name)
+			return s
+		}
+
+		parents[name] = true
+		definition, err = g.expand(definition, fields, parents)
+		delete(parents, name)
+
+		if field == "" {
+			return "(?:" + definition + ")"
+		}
+
+		group := fmt.Sprintf("grok%d", len(fields))
+		fields[group] = field
+
+		return "(?P<" + group + ">" + definition + ")"
+	})
+
+	return expanded, err
+}
+
+// grokPatterns are the built-in patterns, RE2 compatible versions of the common grok patterns
+var grokPatterns = map[string]string{
+	"USERNAME":       `[a-zA-Z0-9._-]+`,
+	"USER":           `%{USERNAME}`,
+	"EMAILLOCALPART": `[a-zA-Z0-9!#$%&'*+/=?^_{|}~-]+(?:\.[a-zA-Z0-9!#$%&'*+/=?^_{|}~-]+)*`,
+	"EMAILADDRESS":   `%{EMAILLOCALPART}@%{HOSTNAME}`,
+	"INT":            `[+-]?[0-9]+`,
+	"BASE10NUM":      `[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)`,
+	"NUMBER":         `%{BASE10NUM}`,
+	"BASE16NUM":      `[+-]?(?:0x)?[0-9A-Fa-f]+`,
+	"POSINT":         `\b[1-9][0-9]*\b`,
+	"NONNEGINT":      `\b[0-9]+\b`,
+	"WORD":           `\b\w+\b`,
+	"NOTSPACE":       `\S+`,
+	"SPACE":          `\s*`,
+	"DATA":           `.*?`,
+	"GREEDYDATA":     `.*`,
+	"QUOTEDSTRING":   `"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`,
+	"QS":             `%{QUOTEDSTRING}`,
+	"UUID":           `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"MAC":            `(?:[A-Fa-f0-9]{2}[:-]){5}[A-Fa-f0-9]{2}`,
+	"IPV4":           `(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])`,
+	"IPV6": `(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}|(?:[0-9A-Fa-f]{1,4}:){1,4}:%{IPV4}|::(?:ffff(?::0{1,4})?:)?%{IPV4}|` +
+		`(?:[0-9A-Fa-f]{1,4}:){1,6}:[0-9A-Fa-f]{1,4}|(?:[0-9A-Fa-f]{1,4}:){1,5}(?::[0-9A-Fa-f]{1,4}){1,2}|` +
+		`(?:[0-9A-Fa-f]{1,4}:){1,4}(?::[0-9A-Fa-f]{1,4}){1,3}|(?:[0-9A-Fa-f]{1,4}:){1,3}(?::[0-9A-Fa-f]{1,4}){1,4}|` +
+		`(?:[0-9A-Fa-f]{1,4}:){1,2}(?::[0-9A-Fa-f]{1,4}){1,5}|[0-9A-Fa-f]{1,4}:(?::[0-9A-Fa-f]{1,4}){1,6}|` +
+		`(?:[0-9A-Fa-f]{1,4}:){1,7}:|:(?::[0-9A-Fa-f]{1,4}){1,7}|::`,
+	"IP":                `%{IPV6}|%{IPV4}`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?`,
+	"IPORHOST":          `%{IP}|%{HOSTNAME}`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"UNIXPATH":          `(?:/[\w%!$@:.,+~-]*)+`,
+	"PATH":              `%{UNIXPATH}`,
+	"URIPROTO":          `[A-Za-z][A-Za-z0-9+.-]+`,
+	"URIHOST":           `%{IPORHOST}(?::%{POSINT})?`,
+	"URIPATH":           `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIPARAM":          `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"URIPATHPARAM":      `%{URIPATH}(?:%{URIPARAM})?`,
+	"URI":               `%{URIPROTO}://(?:%{USER}(?::[^@]*)?@)?(?:%{URIHOST})?(?:%{URIPATHPARAM})?`,
+	"MONTH":             `\b(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:tember)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\b`,
+	"MONTHNUM":          `0?[1-9]|1[0-2]`,
+	"MONTHDAY":          `0[1-9]|[12][0-9]|3[01]|[1-9]`,
+	"DAY":               `Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?`,
+	"YEAR":              `(?:\d\d){1,2}`,
+	"HOUR":              `2[0123]|[01]?[0-9]`,
+	"MINUTE":            `[0-5][0-9]`,
+	"SECOND":            `(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"DATE_US":           `%{MONTHNUM}[/-]%{MONTHDAY}[/-]%{YEAR}`,
+	"DATE_EU":           `%{MONTHDAY}[./-]%{MONTHNUM}[./-]%{YEAR}`,
+	"DATE":              `%{DATE_US}|%{DATE_EU}`,
+	"DATESTAMP":         `%{DATE}[- ]%{TIME}`,
+	"TZ":                `[APMCE][SD]T|UTC`,
+	"ISO8601_TIMEZONE":  `Z|[+-]%{HOUR}(?::?%{MINUTE})`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?(?:%{ISO8601_TIMEZONE})?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"LOGLEVEL": `[Aa]lert|ALERT|[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo(?:rmation)?|INFO(?:RMATION)?|` +
+		`[Ww]arn(?:ing)?|WARN(?:ING)?|[Ee]rr(?:or)?|ERR(?:OR)?|[Cc]rit(?:ical)?|CRIT(?:ICAL)?|[Ff]atal|FATAL|` +
+		`[Ss]evere|SEVERE|[Ee]merg(?:ency)?|EMERG(?:ENCY)?`,
+
+	// syslog
+	"SYSLOGTIMESTAMP": `%{MONTH} +%{MONTHDAY} %{TIME}`,
+	"PROG":            `[\x21-\x5a\x5c\x5e-\x7e]+`,
+	"SYSLOGPROG":      `%{PROG:program}(?:\[%{POSINT:pid}\])?`,
+	"SYSLOGHOST":      `%{IPORHOST}`,
+	"SYSLOGFACILITY":  `<%{NONNEGINT:facility}.%{NONNEGINT:priority}>`,
+	"SYSLOGBASE":      `%{SYSLOGTIMESTAMP:timestamp} (?:%{SYSLOGFACILITY} )?%{SYSLOGHOST:logsource} %{SYSLOGPROG}:`,
+	"SYSLOGLINE":      `%{SYSLOGBASE} %{GREEDYDATA:message}`,
+
+	// apache
+	"HTTPDUSER":       `%{EMAILADDRESS}|%{USER}`,
+	"HTTPDERROR_DATE": `%{DAY} %{MONTH} %{MONTHDAY} %{TIME} %{YEAR}`,
+	"HTTPD_ERRORCODE": `AH[0-9]+`,
+	"COMMONAPACHELOG": `%{IPORHOST:clientip} %{HTTPDUSER:ident} %{HTTPDUSER:auth} \[%{HTTPDATE:timestamp}\] ` +
+		`"(?:%{WORD:verb} %{NOTSPACE:request}(?: HTTP/%{NUMBER:httpversion})?|%{DATA:rawrequest})" ` +
+		`%{NUMBER:response} (?:%{NUMBER:bytes}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} %{QS:referrer} %{QS:agent}`,
+	"HTTPD_ERRORLOG": `\[%{HTTPDERROR_DATE:timestamp}\] \[(?:%{WORD:module})?:%{LOGLEVEL:loglevel}\] ` +
+		`\[pid %{POSINT:pid}(?::tid %{INT:tid})?\](?: \[client %{IPORHOST:clientip}(?::%{POSINT:clientport})?\])? ` +
+		`(?:%{HTTPD_ERRORCODE:errorcode}: )?%{GREEDYDATA:message}`,
+
+	// nginx
+	"NGINXACCESS": `%{IPORHOST:remote_addr} - %{USER:remote_user} \[%{HTTPDATE:time_local}\] ` +
+		`"(?:%{WORD:method} %{NOTSPACE:request}(?: HTTP/%{NUMBER:http_version})?|%{DATA:rawrequest})" ` +
+		`%{NUMBER:status} (?:%{NUMBER:body_bytes_sent}|-) %{QS:http_referer} %{QS:http_user_agent}`,
+	"NGINXERROR_DATE": `%{YEAR}/%{MONTHNUM}/%{MONTHDAY} %{TIME}`,
+	"NGINXERROR": `%{NGINXERROR_DATE:timestamp} \[%{LOGLEVEL:level}\] %{POSINT:pid}#%{NONNEGINT:tid}: ` +
+		`(?:\*%{NONNEGINT:connection} )?%{GREEDYDATA:message}`,
+
+	// postgresql with the default log_line_prefix '%m [%p] ' optionally followed by '%q%u@%d '
+	"POSTGRESQL_LEVEL": `DEBUG[1-5]?|INFO|NOTICE|WARNING|ERROR|LOG|FATAL|PANIC|DETAIL|HINT|CONTEXT|STATEMENT|QUERY`,
+	"POSTGRESQL": `%{TIMESTAMP_ISO8601:timestamp}(?: [A-Za-z_/+-]+)? \[%{POSINT:pid}\] ` +
+		`(?:%{USERNAME:user}@%{USERNAME:database} )?%{POSTGRESQL_LEVEL:level}:\s+%{GREEDYDATA:message}`,
+
+	// mysql slow query log header lines, use multiline assembly with the start pattern "^# Time:"
+	"MYSQL_SLOWUSERHOST": `# User@Host: %{USER:user}\[[^\]]*\] @ (?:%{IPORHOST:host})? \[(?:%{IP:ip})?\]`,
+	"MYSQL_SLOWQUERY": `# Query_time: %{NUMBER:query_time}\s+Lock_time: %{NUMBER:lock_time}\s+` +
+		`Rows_sent: %{NUMBER:rows_sent}\s+Rows_examined: %{NUMBER:rows_examined}`,
+}
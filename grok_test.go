@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGrokBuiltinPatterns(t *testing.T) {
+	grok, err := NewGrok(GrokConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name := range grokPatterns {
+		if _, _, err := grok.Compile("%{" + name + "}"); err != nil {
+			t.Errorf("pattern %s compile error: %v", name, err)
+		}
+	}
+}
+
+func TestGrokFilterFields(t *testing.T) {
+	dir := t.TempDir()
+	patternsFile := filepath.Join(dir, "patterns")
+
+	err := os.WriteFile(patternsFile, []byte("# custom patterns\n\nORDERID\tORD-[0-9]+\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grok, err := NewGrok(GrokConfig{
+		PatternFiles: []string{patternsFile},
+		Patterns:     map[string]string{"PAYMENT": `payment %{ORDERID:order.id} failed`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		cfg      FilterConfig
+		text     string
+		matched  bool
+		expected map[string]string
+	}{
+		{
+			"1. Nginx combined log",
+			FilterConfig{Pattern: "%{NGINXACCESS}", Conditions: []string{"status >= 500"}},
+			`10.0.0.1 - - [12/Oct/2023:10:15:25 +0000] "GET /api/users?id=1 HTTP/1.1" 502 157 "-" "curl/8.0"`,
+			true,
+			map[string]string{
+				"remote_addr":     "10.0.0.1",
+				"remote_user":     "-",
+				"time_local":      "12/Oct/2023:10:15:25 +0000",
+				"method":          "GET",
+				"request":         "/api/users?id=1",
+				"http_version":    "1.1",
+				"status":          "502",
+				"body_bytes_sent": "157",
+				"http_referer":    `"-"`,
+				"http_user_agent": `"curl/8.0"`,
+			},
+		},
+		{
+			"2. Condition doesn't match",
+			FilterConfig{Pattern: "%{NGINXACCESS}", Conditions: []string{"status >= 500"}},
+			`10.0.0.1 - - [12/Oct/2023:10:15:25 +0000] "GET / HTTP/1.1" 200 15 "-" "curl/8.0"`,
+			false,
+			nil,
+		},
+		{
+			"3. Syslog line",
+			FilterConfig{Pattern: "%{SYSLOGLINE}"},
+			"Oct 12 10:15:25 web1 sshd[1234]: Failed password for root",
+			true,
+			map[string]string{
+				"timestamp": "Oct 12 10:15:25",
+				"logsource": "web1",
+				"program":   "sshd",
+				"pid":       "1234",
+				"message":   "Failed password for root",
+			},
+		},
+		{
+			"4. Postgresql log",
+			FilterConfig{Pattern: "%{POSTGRESQL}", Exceptions: []string{"%{POSTGRESQL_LEVEL:level}:  canceling"}},
+			"2023-10-12 10:15:25.123 UTC [4321] app@shop ERROR:  duplicate key value violates unique constraint",
+			true,
+			map[string]string{
+				"timestamp": "2023-10-12 10:15:25.123",
+				"pid":       "4321",
+				"user":      "app",
+				"database":  "shop",
+				"level":     "ERROR",
+				"message":   "duplicate key value violates unique constraint",
+			},
+		},
+		{
+			"5. Custom patterns and regexp",
+			FilterConfig{Pattern: `^ERROR %{PAYMENT}(?: after (\d+) retries)?`},
+			"ERROR payment ORD-42 failed",
+			true,
+			map[string]string{"order.id": "ORD-42"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewFilter(tt.cfg, "host", nil, grok)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			record, ok := filter.Match(Record{Text: tt.text})
+			if ok != tt.matched {
+				t.Fatalf("matched %v, expected %v", ok, tt.matched)
+			}
+			if ok && !reflect.DeepEqual(record.Fields, tt.expected) {
+				t.Errorf("got %v, expected %v", record.Fields, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGrokCompileError(t *testing.T) {
+	grok, err := NewGrok(GrokConfig{Patterns: map[string]string{"LOOP": "a%{LOOP}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pattern := range []string{"%{UNKNOWN:field}", "%{LOOP}", "%{WORD:word}("} {
+		if _, _, err := grok.Compile(pattern); err == nil {
+			t.Errorf("expected error for pattern '%s'", pattern)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyFileMask = syscall.IN_MODIFY | syscall.IN_MOVE_SELF | syscall.IN_DELETE_SELF
+
+// fileEvents notifies about log file changes using inotify.
+// The parent directory is watched too to follow the file after rotation
+type fileEvents struct {
+	C      chan struct{}
+	fd     int
+	file   *os.File
+	path   string
+	dirWd  int
+	fileWd int
+}
+
+func newFileEvents(path string) (*fileEvents, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init error: %v", err)
+	}
+
+	fe := &fileEvents{
+		C:      make(chan struct{}, 1),
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		path:   path,
+		fileWd: -1,
+	}
+
+	fe.dirWd, err = syscall.InotifyAddWatch(fd, filepath.Dir(path), syscall.IN_CREATE|syscall.IN_MOVED_TO)
+	if err != nil {
+		fe.file.Close()
+		return nil, fmt.Errorf("inotify watch error: %v path: %s", err, filepath.Dir(path))
+	}
+
+	if err = fe.watchFile(); err != nil {
+		fe.file.Close()
+		return nil, err
+	}
+
+	go fe.read()
+
+	return fe, nil
+}
+
+// watchFile (re)adds the watch of the log file, e.g. after rotation
+func (fe *fileEvents) watchFile() error {
+	wd, err := syscall.InotifyAddWatch(fe.fd, fe.path, inotifyFileMask)
+	if err != nil {
+		return fmt.Errorf("inotify watch error: %v path: %s", err, fe.path)
+	}
+
+	if fe.fileWd != -1 && fe.fileWd != wd {
+		syscall.InotifyRmWatch(fe.fd, uint32(fe.fileWd))
+	}
+
+	fe.fileWd = wd
+
+	return nil
+}
+
+func (fe *fileEvents) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	name := filepath.Base(fe.path)
+
+	for {
+		n, err := fe.file.Read(buf)
+		if err != nil {
+			// the descriptor is closed
+			return
+		}
+
+		changed := false
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			switch {
+			case int(event.Wd) == fe.dirWd:
+				if trimNull(nameBytes) == name {
+					// the new log file was created after rotation
+					fe.watchFile()
+					changed = true
+				}
+			case int(event.Wd) == fe.fileWd:
+				if event.Mask&syscall.IN_IGNORED != 0 {
+					fe.fileWd = -1
+				}
+				changed = true
+			}
+		}
+
+		if changed {
+			select {
+			case fe.C <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (fe *fileEvents) Close() error {
+	return fe.file.Close()
+}
+
+func trimNull(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
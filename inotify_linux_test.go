@@ -0,0 +1,62 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileEvents(t *testing.T) {
+	logFilePath := filepath.Join(t.TempDir(), "test.log")
+	createFileWithData(logFilePath, []byte("first line\n"))
+
+	fileEvents, err := newFileEvents(logFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileEvents.Close()
+
+	appendData := func(data string) {
+		file, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if _, err = file.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitEvent := func(step string) {
+		select {
+		case <-fileEvents.C:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: expected file change event", step)
+		}
+	}
+
+	appendData("second line\n")
+	waitEvent("1. Append")
+
+	if err = os.Rename(logFilePath, logFilePath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent("2. Rotation")
+
+	createFileWithData(logFilePath, []byte{})
+	waitEvent("3. New file")
+
+	// drain events of the new file creation
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-fileEvents.C:
+	default:
+	}
+
+	appendData("third line\n")
+	waitEvent("4. Append after rotation")
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type fileEvents struct {
+	C chan struct{}
+}
+
+func newFileEvents(path string) (*fileEvents, error) {
+	return nil, fmt.Errorf("inotify is not supported on %s", runtime.GOOS)
+}
+
+func (fe *fileEvents) Close() error {
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const SourceTypeJournald = "journald"
+
+type JournaldConfig struct {
+	Units       []string `yaml:"units"`
+	Identifiers []string `yaml:"identifiers"`
+	Priority    string   `yaml:"priority"`
+}
+
+// Journald reads systemd journal entries with journalctl
+type Journald struct {
+	sync.Mutex
+	name          string
+	args          []string
+	state         State
+	stateFilePath string
+	checkInterval time.Duration
+	processor     *Processor
+	queue         recordQueue
+	// the cursor of the last queued entry
+	cursor string
+}
+
+type journalEntry struct {
+	Cursor  string
+	Message string
+	// the time the entry is logged, zero if __REALTIME_TIMESTAMP is absent
+	Time time.Time
+}
+
+func NewJournald(cfg FileConfig, filters []*Filter) (*Journald, error) {
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return nil, fmt.Errorf("journald source %s error: %v", cfg.Name, err)
+	}
+
+	stateFilePath, err := stateFilePath(fmt.Sprintf("%s:%s:%v:%v:%s",
+		SourceTypeJournald, cfg.Name, cfg.Units, cfg.Identifiers, cfg.Priority,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	processor, err := NewProcessor(cfg, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journald{
+		name:          cfg.Name,
+		args:          []string{"--output=json", "--follow", "--no-pager"},
+		stateFilePath: stateFilePath,
+		checkInterval: time.Second * time.Duration(cfg.IntervalSec),
+		processor:     processor,
+		queue:         recordQueue{name: "journal " + cfg.Name},
+	}
+
+	for _, unit := range cfg.Units {
+		j.args = append(j.args, "--unit="+unit)
+	}
+
+	for _, identifier := range cfg.Identifiers {
+		j.args = append(j.args, "--identifier="+identifier)
+	}
+
+	if cfg.Priority != "" {
+		j.args = append(j.args, "--priority="+cfg.Priority)
+	}
+
+	err = readState(j.stateFilePath, &j.state)
+	if err != nil {
+		return nil, err
+	}
+
+	j.cursor = j.state.Cursor
+
+	return j, nil
+}
+
+func (j *Journald) watch(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	log.Printf("[INFO] starting monitoring journal: %s", j.name)
+
+	go j.follow(ctx)
+
+	ticker := time.NewTicker(j.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.check(ctx)
+		}
+	}
+}
+
+func (j *Journald) check(ctx context.Context) {
+	j.Lock()
+	records, cursor := j.queue.pop(), j.cursor
+	j.Unlock()
+
+	messages := j.processor.processRecords(records)
+
+	if err := j.processor.sendMessages(ctx, messages); err != nil {
+		log.Printf("[ERROR] journal %s: %v", j.name, err)
+
+		// the records are processed again on the next check
+		j.queue.requeue(records)
+
+		return
+	}
+
+	if cursor == j.state.Cursor {
+		return
+	}
+
+	state := j.state
+	state.Cursor = cursor
+
+	if err := writeState(j.stateFilePath, state); err != nil {
+		log.Fatalf("[ERROR] state update error: %v journal: %s", err, j.name)
+	}
+
+	j.state = state
+}
+
+// follow runs journalctl and restarts it after unexpected exit
+func (j *Journald) follow(ctx context.Context) {
+	for {
+		err := j.readJournal(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("[ERROR] journalctl exited: %v journal: %s, restarting", err, j.name)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(j.checkInterval):
+		}
+	}
+}
+
+func (j *Journald) readJournal(ctx context.Context) error {
+	j.Lock()
+	args := append([]string{}, j.args...)
+	if j.cursor != "" {
+		args = append(args, "--after-cursor="+j.cursor)
+	} else {
+		args = append(args, "--lines=0")
+	}
+	j.Unlock()
+
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(stdout)
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+
+		if len(line) > 0 {
+			entry, err := parseJournalEntry(line)
+			if err != nil {
+				log.Printf("[ERROR] journal entry parsing error: %v journal: %s", err, j.name)
+			} else {
+				j.Lock()
+				j.queue.push(Record{Text: entry.Message, Time: entry.Time})
+				j.cursor = entry.Cursor
+				j.Unlock()
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+
+		if readErr != nil {
+			cmd.Wait()
+			return readErr
+		}
+	}
+
+	return cmd.Wait()
+}
+
+// parseJournalEntry parses the journal entry of the journalctl json output.
+// MESSAGE field is a string or an array of bytes for non UTF-8 messages
+func parseJournalEntry(line []byte) (journalEntry, error) {
+	var (
+		fields map[string]json.RawMessage
+		entry  journalEntry
+	)
+
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return entry, err
+	}
+
+	if err := json.Unmarshal(fields["__CURSOR"], &entry.Cursor); err != nil {
+		return entry, fmt.Errorf("cursor error: %v", err)
+	}
+
+	// __REALTIME_TIMESTAMP is the microseconds since the epoch as a string
+	var realtime string
+	if err := json.Unmarshal(fields["__REALTIME_TIMESTAMP"], &realtime); err == nil {
+		if usec, err := strconv.ParseInt(realtime, 10, 64); err == nil {
+			entry.Time = time.UnixMicro(usec)
+		}
+	}
+
+	message, ok := fields["MESSAGE"]
+	if !ok || string(message) == "null" {
+		return entry, nil
+	}
+
+	if err := json.Unmarshal(message, &entry.Message); err == nil {
+		return entry, nil
+	}
+
+	var messageInts []int
+
+	if err := json.Unmarshal(message, &messageInts); err != nil {
+		return entry, fmt.Errorf("message error: %v", err)
+	}
+
+	messageBytes := make([]byte, 0, len(messageInts))
+	for _, b := range messageInts {
+		messageBytes = append(messageBytes, byte(b))
+	}
+
+	entry.Message = string(messageBytes)
+
+	return entry, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseJournalEntry(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected journalEntry
+		isErr    bool
+	}{
+		{
+			"1. String message",
+			`{"__CURSOR":"s=1;i=2","MESSAGE":"ERROR: connection refused","_SYSTEMD_UNIT":"app.service"}`,
+			journalEntry{Cursor: "s=1;i=2", Message: "ERROR: connection refused"},
+			false,
+		},
+		{
+			"2. Binary message",
+			`{"__CURSOR":"s=1;i=3","MESSAGE":[69,82,82,10]}`,
+			journalEntry{Cursor: "s=1;i=3", Message: "ERR\n"},
+			false,
+		},
+		{
+			"3. Null message",
+			`{"__CURSOR":"s=1;i=4","MESSAGE":null}`,
+			journalEntry{Cursor: "s=1;i=4"},
+			false,
+		},
+		{
+			"4. Realtime timestamp",
+			`{"__CURSOR":"s=1;i=5","__REALTIME_TIMESTAMP":"1697105725000001","MESSAGE":"text"}`,
+			journalEntry{Cursor: "s=1;i=5", Message: "text", Time: time.UnixMicro(1697105725000001)},
+			false,
+		},
+		{
+			"5. Missing cursor",
+			`{"MESSAGE":"text"}`,
+			journalEntry{},
+			true,
+		},
+		{
+			"6. Incorrect json",
+			`{"MESSAGE":`,
+			journalEntry{},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := parseJournalEntry([]byte(tt.line))
+			if (err != nil) != tt.isErr {
+				t.Fatalf("Expected error %v, received %v", tt.isErr, err)
+			}
+
+			if !tt.isErr && entry != tt.expected {
+				t.Errorf("Expected entry %+v, received %+v", tt.expected, entry)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const SourceTypeKubernetes = "kubernetes"
+
+const kubernetesPodsPath = "/var/log/pods"
+
+// criDecoder parses CRI log lines: "<time> <stream> <P|F>[:tags] <message>"
+// and joins partial (P) lines of every stream, the stdout and stderr lines may be interleaved
+type criDecoder struct{}
+
+// NewKubernetesDiscoverer discovers container logs in the pods directory (cfg.Path):
+// <pods dir>/<namespace>_<pod>_<uid>/<container>/<restart count>.log
+// Pod fields: namespace, pod, pod_uid, container
+func NewKubernetesDiscoverer(cfg FileConfig, filters []*Filter) (*Discoverer, error) {
+	podsPath := cfg.Path
+	if podsPath == "" {
+		podsPath = kubernetesPodsPath
+	}
+
+	selector, err := newSelector(cfg.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes source %s %v", cfg.Name, err)
+	}
+
+	pattern := filepath.Join(podsPath, "*_*_*", "*", "*.log")
+
+	return newDiscoverer(cfg, pattern, func(path string) (*Watcher, error) {
+		fields, err := kubernetesPodFields(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !matchSelector(selector, fields) {
+			return nil, nil
+		}
+
+		watcherCfg := cfg
+		watcherCfg.Path = path
+
+		// kubelet rotates logs to <restart count>.log.<timestamp>[.gz]
+		if watcherCfg.Rotation.Scheme == "" {
+			watcherCfg.Rotation.Scheme = RotationGlob
+			watcherCfg.Rotation.Pattern = path + ".*"
+		}
+
+		watcher, err := NewWatcher(watcherCfg, filters)
+		if err != nil {
+			return nil, err
+		}
+
+		watcher.decoder = &criDecoder{}
+		watcher.fields = fields
+
+		return watcher, nil
+	})
+}
+
+func kubernetesPodFields(path string) (map[string]string, error) {
+	containerDir := filepath.Dir(path)
+	podDir := filepath.Base(filepath.Dir(containerDir))
+
+	podParts := strings.Split(podDir, "_")
+	if len(podParts) != 3 {
+		return nil, fmt.Errorf("unexpected pod log directory name %s", podDir)
+	}
+
+	return map[string]string{
+		"namespace": podParts[0],
+		"pod":       podParts[1],
+		"pod_uid":   podParts[2],
+		"container": filepath.Base(containerDir),
+	}, nil
+}
+
+func (d *criDecoder) decode(line string, partial map[string]string) (Record, bool) {
+	if line == "" {
+		return Record{}, false
+	}
+
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 {
+		return Record{Text: line}, true
+	}
+
+	message := ""
+	if len(parts) == 4 {
+		message = parts[3]
+	}
+
+	tags := strings.Split(parts[2], ":")
+
+	switch tags[0] {
+	case "P":
+		partial[parts[1]] += message
+		return Record{}, false
+	case "F":
+	default:
+		return Record{Text: line}, true
+	}
+
+	text := partial[parts[1]] + message
+	delete(partial, parts[1])
+
+	return Record{
+		Text: text,
+		Fields: map[string]string{
+			"stream": parts[1],
+			"time":   parts[0],
+		},
+	}, true
+}
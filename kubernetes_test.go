@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCriDecoder(t *testing.T) {
+	lines := []string{
+		"2023-10-12T10:15:25.669794202Z stdout F first line",
+		"2023-10-12T10:15:26.000000001Z stderr P long line part 1, ",
+		"2023-10-12T10:15:26.000000001Z stdout P stdout part 1, ",
+		"2023-10-12T10:15:26.000000002Z stderr F part 2",
+		"2023-10-12T10:15:26.000000003Z stdout F stdout part 2",
+		"2023-10-12T10:15:27.000000000Z stdout F",
+		"not cri line",
+		"",
+	}
+
+	expected := []Record{
+		{
+			Text:   "first line",
+			Fields: map[string]string{"stream": "stdout", "time": "2023-10-12T10:15:25.669794202Z"},
+		},
+		{
+			Text:   "long line part 1, part 2",
+			Fields: map[string]string{"stream": "stderr", "time": "2023-10-12T10:15:26.000000002Z"},
+		},
+		{
+			Text:   "stdout part 1, stdout part 2",
+			Fields: map[string]string{"stream": "stdout", "time": "2023-10-12T10:15:26.000000003Z"},
+		},
+		{
+			Text:   "",
+			Fields: map[string]string{"stream": "stdout", "time": "2023-10-12T10:15:27.000000000Z"},
+		},
+		{
+			Text: "not cri line",
+		},
+	}
+
+	decoder := &criDecoder{}
+
+	partial := make(map[string]string)
+
+	var records []Record
+	for _, line := range lines {
+		if record, ok := decoder.decode(line, partial); ok {
+			records = append(records, record)
+		}
+	}
+
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Expected records %+v, received %+v", expected, records)
+	}
+}
+
+func TestKubernetesPodFields(t *testing.T) {
+	fields, err := kubernetesPodFields("/var/log/pods/payments_api-7d9f8b6c5-x2kqz_3f1c2d4e-5b6a/api/0.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"namespace": "payments",
+		"pod":       "api-7d9f8b6c5-x2kqz",
+		"pod_uid":   "3f1c2d4e-5b6a",
+		"container": "api",
+	}
+
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected fields %v, received %v", expected, fields)
+	}
+
+	if _, err = kubernetesPodFields("/var/log/pods/incorrect/api/0.log"); err == nil {
+		t.Error("Expected pod directory name error")
+	}
+}
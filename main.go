@@ -32,6 +32,6 @@ func main() {
 	NewApp(cfg).
 		BuildNotifiers().
 		BuildFilters().
-		BuildWatchers().
+		BuildSources().
 		Watch()
 }
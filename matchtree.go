@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MatchConfig is a node of the filter match tree, it has one of:
+// all, any - the lists of nodes, not - the negated node,
+// pattern, condition (field condition expression) or filter (another filter name)
+type MatchConfig struct {
+	All       []MatchConfig `yaml:"all"`
+	Any       []MatchConfig `yaml:"any"`
+	Not       *MatchConfig  `yaml:"not"`
+	Pattern   string        `yaml:"pattern"`
+	Condition string        `yaml:"condition"`
+	Filter    string        `yaml:"filter"`
+}
+
+// matchNode is the compiled match tree node.
+// The filter references are resolved after all filters are built
+type matchNode struct {
+	all        []*matchNode
+	any        []*matchNode
+	not        *matchNode
+	reg        *regexp.Regexp
+	condition  *Condition
+	filterName string
+	filter     *Filter
+}
+
+func newMatchNode(cfg MatchConfig, grok *Grok) (*matchNode, error) {
+	n := &matchNode{}
+	kinds := 0
+
+	if len(cfg.All) > 0 {
+		kinds++
+		for _, childCfg := range cfg.All {
+			child, err := newMatchNode(childCfg, grok)
+			if err != nil {
+				return nil, err
+			}
+			n.all = append(n.all, child)
+		}
+	}
+
+	if len(cfg.Any) > 0 {
+		kinds++
+		for _, childCfg := range cfg.Any {
+			child, err := newMatchNode(childCfg, grok)
+			if err != nil {
+				return nil, err
+			}
+			n.any = append(n.any, child)
+		}
+	}
+
+	if cfg.Not != nil {
+		kinds++
+		child, err := newMatchNode(*cfg.Not, grok)
+		if err != nil {
+			return nil, err
+		}
+		n.not = child
+	}
+
+	if cfg.Pattern != "" {
+		kinds++
+		reg, _, err := grok.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("match pattern %s compile error: %v", cfg.Pattern, err)
+		}
+		n.reg = reg
+	}
+
+	if cfg.Condition != "" {
+		kinds++
+		condition, err := NewCondition(cfg.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("match %v", err)
+		}
+		n.condition = condition
+	}
+
+	if cfg.Filter != "" {
+		kinds++
+		n.filterName = cfg.Filter
+	}
+
+	if kinds != 1 {
+		return nil, fmt.Errorf("match node must have one of all, any, not, pattern, condition, filter")
+	}
+
+	return n, nil
+}
+
+// match reports whether the record matches the node.
+// The record fields are the source fields and the filter pattern captures
+func (n *matchNode) match(record Record) bool {
+	switch {
+	case n.all != nil:
+		for _, child := range n.all {
+			if !child.match(record) {
+				return false
+			}
+		}
+		return true
+	case n.any != nil:
+		for _, child := range n.any {
+			if child.match(record) {
+				return true
+			}
+		}
+		return false
+	case n.not != nil:
+		return !n.not.match(record)
+	case n.reg != nil:
+		return n.reg.MatchString(record.Text)
+	case n.condition != nil:
+		return n.condition.Match(record.Fields)
+	case n.filter != nil:
+		_, ok := n.filter.Match(record)
+		return ok
+	}
+
+	return false
+}
+
+// walk calls the function for the node and all its descendants
+func (n *matchNode) walk(fn func(n *matchNode) error) error {
+	if err := fn(n); err != nil {
+		return err
+	}
+
+	children := append(append([]*matchNode(nil), n.all...), n.any...)
+	if n.not != nil {
+		children = append(children, n.not)
+	}
+
+	for _, child := range children {
+		if err := child.walk(fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResolveFilters links the filter references of the match trees
+// and checks that the filters don't reference themselves
+func ResolveFilters(filters []*Filter) error {
+	byName := make(map[string]*Filter, len(filters))
+	for _, filter := range filters {
+		if _, ok := byName[filter.Name]; !ok {
+			byName[filter.Name] = filter
+		}
+	}
+
+	for _, filter := range filters {
+		if filter.MatchTree == nil {
+			continue
+		}
+
+		err := filter.MatchTree.walk(func(n *matchNode) error {
+			if n.filterName == "" {
+				return nil
+			}
+
+			ref, ok := byName[n.filterName]
+			if !ok {
+				return fmt.Errorf("LogFile filter %s match filter %s is not found", filter.Name, n.filterName)
+			}
+			n.filter = ref
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the references are checked for cycles by the depth-first search
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	states := make(map[*Filter]int, len(filters))
+	var path []string
+
+	var visit func(filter *Filter) error
+	visit = func(filter *Filter) error {
+		switch states[filter] {
+		case visiting:
+			return fmt.Errorf("LogFile filter %s match filter reference cycle: %s", filter.Name,
+				strings.Join(append(path, filter.Name), " -> "))
+		case visited:
+			return nil
+		}
+
+		if filter.MatchTree == nil {
+			states[filter] = visited
+			return nil
+		}
+
+		states[filter] = visiting
+		path = append(path, filter.Name)
+
+		err := filter.MatchTree.walk(func(n *matchNode) error {
+			if n.filter == nil {
+				return nil
+			}
+			return visit(n.filter)
+		})
+		if err != nil {
+			return err
+		}
+
+		path = path[:len(path)-1]
+		states[filter] = visited
+
+		return nil
+	}
+
+	for _, filter := range filters {
+		if err := visit(filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterMatchTree(t *testing.T) {
+	grok := &Grok{}
+
+	healthcheck, err := NewFilter(FilterConfig{Name: "healthcheck", Pattern: `GET /health`}, "host", nil, grok)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ERROR and (payment or checkout) but not healthcheck
+	filter, err := NewFilter(FilterConfig{
+		Name: "shop",
+		Match: &MatchConfig{All: []MatchConfig{
+			{Pattern: `ERROR`},
+			{Any: []MatchConfig{{Pattern: `payment`}, {Condition: `service == checkout`}}},
+			{Not: &MatchConfig{Filter: "healthcheck"}},
+		}},
+	}, "host", nil, grok)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ResolveFilters([]*Filter{healthcheck, filter}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		record   Record
+		expected bool
+	}{
+		{"1. All match", Record{Text: "ERROR payment declined"}, true},
+		{"2. Any field condition", Record{Text: "ERROR timeout", Fields: map[string]string{"service": "checkout"}}, true},
+		{"3. No any match", Record{Text: "ERROR timeout", Fields: map[string]string{"service": "search"}}, false},
+		{"4. Not referenced filter", Record{Text: "ERROR payment GET /health"}, false},
+		{"5. No all match", Record{Text: "WARN payment declined"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, ok := filter.Match(test.record); ok != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, ok)
+			}
+		})
+	}
+}
+
+func TestResolveFiltersErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfgs     []FilterConfig
+		expected string
+	}{
+		{
+			"1. Unknown filter",
+			[]FilterConfig{{Name: "a", Match: &MatchConfig{Filter: "b"}}},
+			"match filter b is not found",
+		},
+		{
+			"2. Self reference",
+			[]FilterConfig{{Name: "a", Match: &MatchConfig{Not: &MatchConfig{Filter: "a"}}}},
+			"reference cycle: a -> a",
+		},
+		{
+			"3. Indirect cycle",
+			[]FilterConfig{
+				{Name: "a", Match: &MatchConfig{Filter: "b"}},
+				{Name: "b", Match: &MatchConfig{Any: []MatchConfig{{Pattern: "x"}, {Filter: "c"}}}},
+				{Name: "c", Match: &MatchConfig{Filter: "a"}},
+			},
+			"reference cycle: a -> b -> c -> a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var filters []*Filter
+
+			for _, cfg := range test.cfgs {
+				filter, err := NewFilter(cfg, "host", nil, &Grok{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				filters = append(filters, filter)
+			}
+
+			err := ResolveFilters(filters)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestMatchNodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  MatchConfig
+	}{
+		{"1. Empty node", MatchConfig{}},
+		{"2. Several kinds", MatchConfig{Pattern: "a", Filter: "b"}},
+		{"3. Pattern error", MatchConfig{All: []MatchConfig{{Pattern: "("}}}},
+		{"4. Condition error", MatchConfig{Not: &MatchConfig{Condition: "level"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newMatchNode(test.cfg, &Grok{}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
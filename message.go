@@ -1,27 +1,127 @@
 package main
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// maxMessageLines limits the number of the original lines kept in the message
+const maxMessageLines = 100
+
 type Message struct {
-	FileName string
-	Subject  string
-	Text     string
-	Count    int
-	Filter   *Filter
+	FileName  string
+	FilePath  string
+	Subject   string
+	Text      string
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Lines     []string
+	// the lines before and after the first matched line
+	ContextBefore []string
+	ContextAfter  []string
+	Fields        map[string]string
+	// the aggregation key: the (normalized) line without date or the group key
+	Key string
+	// the aggregation key of the filter with groupBy
+	GroupKey string
+	// the alert of the threshold and absence filters, the firing and resolved messages
+	// have the same alert ID
+	AlertID string
+	// the alert condition is cleared, e.g. the absent records appeared
+	Resolved bool
+	// the number of the repeated firing message of the alert, 0 for the first one
+	Repeat int
+	// the firing message references by notifier name, e.g. telegram message ID
+	Refs map[string]string
+	// the number of the identical messages suppressed by the filter cooldown since the time
+	Suppressed      int
+	SuppressedSince time.Time
+	Filter          *Filter `json:"-"`
+}
+
+// Render builds the message subject and text for the notifier.
+// The text is escaped for the notifier format with the escape function
+func (msg *Message) Render(notifier string, templates Templates, escape func(string) string) error {
+	templates = msg.templates(notifier, templates)
+
+	data := msg.data()
+
+	// the legacy text is followed by the suppressed count, in the escaped formats
+	// it follows the text value, so the markup of the template is kept valid
+	var suppressed string
+	if msg.Suppressed > 0 && templates.Text.legacy() {
+		suppressed = fmt.Sprintf("\n… and %d more since %s", msg.Suppressed, msg.SuppressedSince.Format("15:04"))
+		if escape != nil {
+			data.Text, suppressed = data.Text+suppressed, ""
+		}
+	}
+
+	subject, err := templates.Subject.Render(data, nil)
+	if err != nil {
+		return fmt.Errorf("subject template error: %v", err)
+	}
+
+	text, err := templates.Text.Render(data, escape)
+	if err != nil {
+		return fmt.Errorf("message template error: %v", err)
+	}
+
+	msg.Subject, msg.Text = subject, text+suppressed
+
+	return nil
+}
+
+// templates returns the message templates for the notifier, taken in order:
+// the filter templates for the notifier, the notifier templates, the filter templates
+func (msg *Message) templates(notifier string, templates Templates) Templates {
+	return msg.Filter.NotifierTemplates[notifier].merge(templates).merge(msg.Filter.Templates)
+}
+
+func (msg *Message) data() MessageData {
+	return MessageData{
+		Host:            msg.Filter.Hostname,
+		File:            msg.FileName,
+		FilePath:        msg.FilePath,
+		Filter:          msg.Filter.Name,
+		Count:           msg.Count,
+		FirstSeen:       msg.FirstSeen,
+		LastSeen:        msg.LastSeen,
+		Fields:          msg.Fields,
+		Lines:           msg.Lines,
+		ContextBefore:   msg.ContextBefore,
+		ContextAfter:    msg.ContextAfter,
+		Text:            msg.Text,
+		AlertID:         msg.AlertID,
+		Suppressed:      msg.Suppressed,
+		SuppressedSince: msg.SuppressedSince,
+		Status:          msg.Status(),
+		Resolved:        msg.Resolved,
+	}
+}
+
+// cooldownKey returns the key of the identical messages
+func (msg *Message) cooldownKey() string {
+	if msg.Key != "" {
+		return msg.Key
+	}
+	return msg.Text
 }
 
-func (msg *Message) BuildSubject() {
-	msg.Subject = strings.Replace(msg.Filter.SubjectFormat, "%filename", msg.FileName, -1)
-	msg.Subject = strings.Replace(msg.Subject, "%filtername", msg.Filter.Name, -1)
-	msg.Subject = strings.Replace(msg.Subject, "%count", strconv.Itoa(msg.Count), -1)
+// deliveryKey returns the key of the message sent to the notifier,
+// the same records processed again have the same key
+func (msg *Message) deliveryKey(notifier string) string {
+	return strings.Join([]string{
+		notifier, msg.Filter.Name, msg.Status(), strconv.Itoa(msg.Repeat), msg.GroupKey, msg.cooldownKey(),
+	}, "\x00")
 }
 
-func (msg *Message) BuildText() {
-	msg.Text = strings.Replace(msg.Filter.TextFormat, "%filename", msg.FileName, -1)
-	msg.Text = strings.Replace(msg.Text, "%filtername", msg.Filter.Name, -1)
-	msg.Text = strings.Replace(msg.Text, "%count", strconv.Itoa(msg.Count), -1)
-	msg.Text = strings.Replace(msg.Text, "%text", msg.Text, -1)
+// Status returns the alert status of the message
+func (msg *Message) Status() string {
+	if msg.Resolved {
+		return AlertStatusResolved
+	}
+	return AlertStatusFiring
 }
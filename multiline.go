@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type MultilineConfig struct {
+	Start           string `yaml:"start"`
+	Continuation    string `yaml:"continuation"`
+	MaxLines        int    `yaml:"maxLines"`
+	MaxBytes        int    `yaml:"maxBytes"`
+	FlushTimeoutSec uint   `yaml:"flushTimeout"`
+}
+
+// multiline assembles records of several lines (e.g. stack traces).
+// A line matching the start pattern begins a new record, other lines are continuations.
+// With the continuation pattern only the matching lines are continuations.
+// The last record is kept until the flush timeout since its last line is over,
+// so its continuation lines may be read on the next check
+type multiline struct {
+	startReg        *regexp.Regexp
+	continuationReg *regexp.Regexp
+	maxLines        int
+	maxBytes        int
+	flushTimeout    time.Duration
+	pending         *Record
+	pendingLines    int
+	pendingTime     time.Time
+}
+
+// multilineState is the record held by the multiline assembly between checks
+type multilineState struct {
+	Record *Record   `json:"record,omitempty"`
+	Lines  int       `json:"lines,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// newMultiline returns nil if the multiline records assembly is not configured
+func newMultiline(cfg MultilineConfig) (*multiline, error) {
+	if cfg.Start == "" && cfg.Continuation == "" {
+		return nil, nil
+	}
+
+	m := &multiline{
+		maxLines:     cfg.MaxLines,
+		maxBytes:     cfg.MaxBytes,
+		flushTimeout: time.Second * time.Duration(cfg.FlushTimeoutSec),
+	}
+
+	var err error
+
+	if cfg.Start != "" {
+		m.startReg, err = regexp.Compile(cfg.Start)
+		if err != nil {
+			return nil, fmt.Errorf("multiline start pattern compile error: %v", err)
+		}
+	}
+
+	if cfg.Continuation != "" {
+		m.continuationReg, err = regexp.Compile(cfg.Continuation)
+		if err != nil {
+			return nil, fmt.Errorf("multiline continuation pattern compile error: %v", err)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *multiline) isContinuation(line string) bool {
+	if m.startReg != nil && m.startReg.MatchString(line) {
+		return false
+	}
+
+	if m.continuationReg != nil {
+		return m.continuationReg.MatchString(line)
+	}
+
+	return true
+}
+
+// assemble joins continuation lines with the preceding record.
+// Empty lines are skipped
+func (m *multiline) assemble(records []Record, now time.Time) []Record {
+	var result []Record
+
+	if m.pending != nil && now.Sub(m.pendingTime) >= m.flushTimeout {
+		result = append(result, *m.pending)
+		m.pending = nil
+	}
+
+	for _, record := range records {
+		if record.Text == "" {
+			continue
+		}
+
+		if m.pending != nil && m.isContinuation(record.Text) {
+			m.append(record.Text)
+			m.pendingTime = now
+			continue
+		}
+
+		if m.pending != nil {
+			result = append(result, *m.pending)
+		}
+
+		pending := record
+		m.pending = &pending
+		m.pendingLines = 1
+		m.pendingTime = now
+	}
+
+	if m.pending != nil && m.flushTimeout == 0 {
+		result = append(result, *m.pending)
+		m.pending = nil
+	}
+
+	return result
+}
+
+// append adds the line to the pending record, the lines over the limits are dropped
+func (m *multiline) append(line string) {
+	if m.maxLines > 0 && m.pendingLines >= m.maxLines {
+		return
+	}
+
+	if m.maxBytes > 0 && len(m.pending.Text)+len(line)+1 > m.maxBytes {
+		return
+	}
+
+	var text strings.Builder
+	text.Grow(len(m.pending.Text) + len(line) + 1)
+	text.WriteString(m.pending.Text)
+	text.WriteByte('\n')
+	text.WriteString(line)
+
+	m.pending.Text = text.String()
+	m.pendingLines++
+}
+
+// state returns the copy of the held record
+func (m *multiline) state() multilineState {
+	state := multilineState{Lines: m.pendingLines, Time: m.pendingTime}
+
+	if m.pending != nil {
+		record := *m.pending
+		state.Record = &record
+	}
+
+	return state
+}
+
+// restore sets the held record, e.g. after the messages sending failure
+func (m *multiline) restore(state multilineState) {
+	m.pending = state.Record
+	m.pendingLines = state.Lines
+	m.pendingTime = state.Time
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMultilineAssemble(t *testing.T) {
+	javaTrace := []string{
+		"2023-10-12 10:15:25 ERROR Request failed",
+		"java.lang.NullPointerException: null",
+		"\tat com.foo.Bar.baz(Bar.java:42)",
+		"\tat com.foo.Main.main(Main.java:7)",
+		"2023-10-12 10:15:26 INFO Next request",
+		"",
+	}
+
+	tests := []struct {
+		name     string
+		cfg      MultilineConfig
+		lines    []string
+		expected []string
+	}{
+		{
+			"1. Start pattern",
+			MultilineConfig{Start: `^\d{4}-\d{2}-\d{2}`},
+			javaTrace,
+			[]string{
+				"2023-10-12 10:15:25 ERROR Request failed\njava.lang.NullPointerException: null\n" +
+					"\tat com.foo.Bar.baz(Bar.java:42)\n\tat com.foo.Main.main(Main.java:7)",
+				"2023-10-12 10:15:26 INFO Next request",
+			},
+		},
+		{
+			"2. Continuation pattern",
+			MultilineConfig{Continuation: `^\s`},
+			javaTrace,
+			[]string{
+				"2023-10-12 10:15:25 ERROR Request failed",
+				"java.lang.NullPointerException: null\n\tat com.foo.Bar.baz(Bar.java:42)\n\tat com.foo.Main.main(Main.java:7)",
+				"2023-10-12 10:15:26 INFO Next request",
+			},
+		},
+		{
+			"3. Max lines",
+			MultilineConfig{Start: `^\d{4}-\d{2}-\d{2}`, MaxLines: 2},
+			javaTrace,
+			[]string{
+				"2023-10-12 10:15:25 ERROR Request failed\njava.lang.NullPointerException: null",
+				"2023-10-12 10:15:26 INFO Next request",
+			},
+		},
+		{
+			"4. Max bytes",
+			MultilineConfig{Start: `^\d{4}-\d{2}-\d{2}`, MaxBytes: 80},
+			javaTrace,
+			[]string{
+				"2023-10-12 10:15:25 ERROR Request failed\njava.lang.NullPointerException: null",
+				"2023-10-12 10:15:26 INFO Next request",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMultiline(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var records []Record
+			for _, line := range tt.lines {
+				records = append(records, Record{Text: line})
+			}
+
+			var texts []string
+			for _, record := range m.assemble(records, time.Now()) {
+				texts = append(texts, record.Text)
+			}
+
+			if !reflect.DeepEqual(texts, tt.expected) {
+				t.Errorf("Expected records %q, received %q", tt.expected, texts)
+			}
+		})
+	}
+}
+
+func TestMultilineFlushTimeout(t *testing.T) {
+	m, err := newMultiline(MultilineConfig{Start: `^ERROR`, FlushTimeoutSec: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	records := m.assemble([]Record{{Text: "ERROR first"}, {Text: "  trace 1"}}, now)
+	if len(records) != 0 {
+		t.Fatalf("Expected the record to be kept until the flush timeout, received %+v", records)
+	}
+
+	// continuation lines read on the next check are joined with the kept record
+	records = m.assemble([]Record{{Text: "  trace 2"}}, now.Add(time.Second))
+	if len(records) != 0 {
+		t.Fatalf("Expected the record to be kept until the flush timeout, received %+v", records)
+	}
+
+	records = m.assemble(nil, now.Add(10*time.Second))
+
+	expected := []Record{{Text: "ERROR first\n  trace 1\n  trace 2"}}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Expected records %+v, received %+v", expected, records)
+	}
+}
+
+func TestProcessorMultilineState(t *testing.T) {
+	notifier := &testNotifier{}
+
+	filter, err := NewFilter(FilterConfig{Name: "test", Pattern: "ERROR", Notifications: []string{"test"}},
+		"host", []Notifier{notifier}, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := FileConfig{
+		Name:      "multiline_test",
+		Path:      "/tmp/multiline_test",
+		Multiline: MultilineConfig{Start: `^\d`, FlushTimeoutSec: 60},
+		Filters:   []string{"test"},
+	}
+
+	processor, err := NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	messages := processor.processLines([]string{"1 ERROR failed", "  at a"})
+	if err := processor.sendMessages(context.Background(), messages); err != nil || len(messages) != 0 {
+		t.Fatalf("unexpected messages: %v, error: %v", messages, err)
+	}
+
+	// the held record is restored after restart
+	processor, err = NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lines processed again after the failed send are not joined twice
+	notifier.err = errors.New("connection refused")
+
+	for i := 0; i < 2; i++ {
+		messages = processor.processLines([]string{"  at b", "2 ok"})
+		if len(messages) != 1 || messages[0].Text != "1 ERROR failed\n  at a\n  at b" {
+			t.Fatalf("%d. unexpected messages: %v", i, messages)
+		}
+
+		if err := processor.sendMessages(context.Background(), messages); err == nil {
+			t.Fatalf("%d. expected send error", i)
+		}
+	}
+}
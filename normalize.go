@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	MaskNumbers = "numbers"
+	MaskUUID    = "uuid"
+	MaskHex     = "hex"
+	MaskIP      = "ip"
+	MaskEmail   = "email"
+	MaskQuoted  = "quoted"
+)
+
+type NormalizeConfig struct {
+	Masks        []string            `yaml:"masks"`
+	Replacements []ReplacementConfig `yaml:"replacements"`
+}
+
+type ReplacementConfig struct {
+	Pattern string `yaml:"pattern"`
+	Replace string `yaml:"replace"`
+}
+
+type normalizeRule struct {
+	reg     *regexp.Regexp
+	replace string
+}
+
+// builtinMasks are applied in this order, so the longer tokens are masked
+// before their parts, e.g. an IP address before its numbers
+var builtinMasks = []struct {
+	name    string
+	pattern string
+	replace string
+}{
+	{MaskQuoted, `"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`, "<str>"},
+	{MaskEmail, `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, "<email>"},
+	{MaskUUID, `\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`, "<uuid>"},
+	{MaskIP, `\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b|\b(?:[0-9a-fA-F]{1,4}:){1,7}:(?:[0-9a-fA-F]{1,4}(?::[0-9a-fA-F]{1,4})*\b)?|::[0-9a-fA-F]{1,4}(?::[0-9a-fA-F]{1,4})*\b`, "<ip>"},
+	{MaskIP, `\b(?:\d{1,3}\.){3}\d{1,3}\b`, "<ip>"},
+	{MaskHex, `\b0[xX][0-9a-fA-F]+\b|\b[0-9a-fA-F]{8,}\b`, "<hex>"},
+	{MaskNumbers, `\b\d+(?:\.\d+)?`, "<num>"},
+}
+
+// normalizer replaces the variable parts of lines (IDs, numbers, addresses),
+// so the lines differing only by them are aggregated into one message.
+// The custom replacements are applied before the built-in masks
+type normalizer struct {
+	rules []normalizeRule
+}
+
+// newNormalizer returns nil if the normalization is not configured
+func newNormalizer(cfg NormalizeConfig) (*normalizer, error) {
+	if len(cfg.Masks) == 0 && len(cfg.Replacements) == 0 {
+		return nil, nil
+	}
+
+	n := &normalizer{}
+
+	for _, replacement := range cfg.Replacements {
+		reg, err := regexp.Compile(replacement.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("normalize pattern %s compile error: %v", replacement.Pattern, err)
+		}
+		n.rules = append(n.rules, normalizeRule{reg, replacement.Replace})
+	}
+
+	masks := make(map[string]bool, len(cfg.Masks))
+	for _, mask := range cfg.Masks {
+		if !isBuiltinMask(mask) {
+			return nil, fmt.Errorf("unknown normalize mask %s", mask)
+		}
+		masks[mask] = true
+	}
+
+	for _, mask := range builtinMasks {
+		if masks[mask.name] {
+			n.rules = append(n.rules, normalizeRule{regexp.MustCompile(mask.pattern), mask.replace})
+		}
+	}
+
+	return n, nil
+}
+
+func isBuiltinMask(name string) bool {
+	for _, mask := range builtinMasks {
+		if mask.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize returns the line with the variable parts replaced
+func (n *normalizer) normalize(line string) string {
+	for _, rule := range n.rules {
+		line = rule.reg.ReplaceAllString(line, rule.replace)
+	}
+	return line
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      NormalizeConfig
+		line     string
+		expected string
+	}{
+		{
+			"1. Numbers",
+			NormalizeConfig{Masks: []string{MaskNumbers}},
+			"request 1234 took 15ms, 0.25 cpu, http2",
+			"request <num> took <num>ms, <num> cpu, http2",
+		},
+		{
+			"2. UUID",
+			NormalizeConfig{Masks: []string{MaskUUID, MaskNumbers}},
+			"order 3f2504e0-4f89-11d3-9a0c-0305e82c3301 failed",
+			"order <uuid> failed",
+		},
+		{
+			"3. Hex IDs",
+			NormalizeConfig{Masks: []string{MaskHex}},
+			"trace 5f3a9c2e1b7d at 0x7ffd4a2c, cafe",
+			"trace <hex> at <hex>, cafe",
+		},
+		{
+			"4. IPv4 and IPv6",
+			NormalizeConfig{Masks: []string{MaskIP, MaskNumbers}},
+			"client 192.168.1.10:443 and 2001:db8::8a2e:370:7334, ::1, fe80::1 at 12:30:45",
+			"client <ip>:<num> and <ip>, <ip>, <ip> at <num>:<num>:<num>",
+		},
+		{
+			"5. Email",
+			NormalizeConfig{Masks: []string{MaskEmail}},
+			"mail to john.doe+test@example.com bounced",
+			"mail to <email> bounced",
+		},
+		{
+			"6. Quoted strings",
+			NormalizeConfig{Masks: []string{MaskQuoted}},
+			`user "John \"J\" Doe" not found in 'users'`,
+			`user <str> not found in <str>`,
+		},
+		{
+			"7. Custom replacements before masks",
+			NormalizeConfig{
+				Masks:        []string{MaskNumbers},
+				Replacements: []ReplacementConfig{{Pattern: `session=\S+`, Replace: "session=*"}},
+			},
+			"session=ab12cd user 42",
+			"session=* user <num>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n, err := newNormalizer(test.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line := n.normalize(test.line); line != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, line)
+			}
+		})
+	}
+}
+
+func TestNormalizerErrors(t *testing.T) {
+	if n, err := newNormalizer(NormalizeConfig{}); n != nil || err != nil {
+		t.Errorf("expected no normalizer, got %v, %v", n, err)
+	}
+
+	if _, err := newNormalizer(NormalizeConfig{Masks: []string{"phone"}}); err == nil {
+		t.Error("expected unknown mask error")
+	}
+
+	if _, err := newNormalizer(NormalizeConfig{Replacements: []ReplacementConfig{{Pattern: "("}}}); err == nil {
+		t.Error("expected pattern compile error")
+	}
+}
+
+func TestProcessorNormalize(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{Name: "errors", Pattern: `ERROR`}, "host", nil, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor, err := NewProcessor(FileConfig{
+		Name:       "normalize_test",
+		Path:       "/tmp/normalize_test",
+		DateFormat: `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} `,
+		Normalize:  NormalizeConfig{Masks: []string{MaskIP, MaskNumbers}},
+		Filters:    []string{"errors"},
+	}, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := processor.processLines([]string{
+		"2023-10-12 10:15:25 ERROR pid 1201 connection from 10.0.0.1 refused",
+		"2023-10-12 10:15:26 ERROR pid 1202 connection from 10.0.0.2 refused",
+		"2023-10-12 10:15:27 ERROR disk full",
+	})
+
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %+v", messages)
+	}
+
+	for _, msg := range messages {
+		if msg.Key == "ERROR pid <num> connection from <ip> refused" {
+			// the text is the first real line
+			if msg.Count != 2 || msg.Text != "ERROR pid 1201 connection from 10.0.0.1 refused" || len(msg.Lines) != 2 {
+				t.Errorf("unexpected message: %+v", msg)
+			}
+			return
+		}
+	}
+
+	t.Errorf("normalized message not found: %+v", messages)
+}
@@ -8,8 +8,11 @@ import (
 type Notifier interface {
 	Name() string
 	Type() string
-	FormatText(string) string
-	Send(ctx context.Context, msg Message) error
+	// Render builds the message subject and text in the notifier format
+	Render(msg *Message) error
+	// Send sends the message and returns its reference for the resolved message
+	// of the alert, e.g. telegram message ID
+	Send(ctx context.Context, msg Message) (string, error)
 	Close() error
 }
 
@@ -30,6 +33,11 @@ func NewNotifier(cfg NotificationConfig) (Notifier, error) {
 		if err != nil {
 			return nil, err
 		}
+	case NotifierTypeWebhook:
+		notifier, err = NewWebhookNotifier(cfg)
+		if err != nil {
+			return nil, err
+		}
 	default:
 		return nil, fmt.Errorf("Notifier type '%s' is unsupported", cfg.Type)
 	}
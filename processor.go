@@ -0,0 +1,727 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Processor matches new log lines with the filters of the log source,
+// aggregates identical lines and sends notifications
+type Processor struct {
+	fileName  string
+	filePath  string
+	format    string
+	dateReg   *regexp.Regexp
+	multiline *multiline
+	// the aggregation key of the lines, nil if the lines are aggregated without the date only
+	normalizer *normalizer
+	filters    []*Filter
+
+	// the last records of the previous checks for the context before matches
+	contextSize int
+	context     []string
+	// the messages waiting for the context after lines of the next check
+	pending []pendingMessage
+
+	stateFilePath string
+	state         ProcessorState
+	stateChanged  bool
+	// the state before the processing of the records which messages are not sent yet
+	snapshot *processorSnapshot
+	// the references of the messages sent before the failed send by delivery key,
+	// they are not sent again when the same records are processed after the rollback
+	delivered map[string]string
+	// the IDs of the alerts which firing messages are sent before the failed send by alert key,
+	// the alert started again after the rollback keeps the ID known to the notifiers
+	deliveredAlerts map[string]string
+
+	// the log source modification time, e.g. the log file mtime
+	modTime time.Time
+}
+
+// ProcessorState is the filters state persisted across restarts
+// in the state file next to the log source one
+type ProcessorState struct {
+	// threshold matches counts by filter name
+	Thresholds map[string]*thresholdState `json:"thresholds,omitempty"`
+	// absence last activity by filter name
+	Absences map[string]*absenceState `json:"absences,omitempty"`
+	// firing alerts by alert key
+	Alerts map[string]*alertState `json:"alerts,omitempty"`
+	// the last sent messages of the filters with cooldown by filter name and message key
+	Cooldowns map[string]*cooldownState `json:"cooldowns,omitempty"`
+	// the messages waiting for the context after lines
+	Pending []pendingState `json:"pending,omitempty"`
+	// the multiline record waiting for the continuation lines
+	Multiline *multilineState `json:"multiline,omitempty"`
+}
+
+// pendingState is the persisted pending message, the filter is referenced by name
+type pendingState struct {
+	Filter  string  `json:"filter"`
+	Message Message `json:"message"`
+	Need    int     `json:"need"`
+}
+
+// processorSnapshot is the processor state restored if the messages are not sent,
+// so the records processed again on the next check don't change it twice
+type processorSnapshot struct {
+	state        ProcessorState
+	stateChanged bool
+	context      []string
+	pending      []pendingMessage
+	multiline    multilineState
+}
+
+type pendingMessage struct {
+	msg  Message
+	need int
+}
+
+func NewProcessor(cfg FileConfig, filters []*Filter) (*Processor, error) {
+	p := &Processor{
+		fileName: cfg.Name,
+		filePath: cfg.Path,
+		format:   cfg.Format,
+		filters:  make([]*Filter, 0, len(cfg.Filters)),
+	}
+
+	if err := validateFormat(p.format); err != nil {
+		return nil, fmt.Errorf("LogFile %s %v", cfg.Path, err)
+	}
+
+	for _, filterName := range cfg.Filters {
+		found := false
+		for _, filter := range filters {
+			if filter.Name == filterName {
+				p.filters = append(p.filters, filter)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown filter: %s", filterName)
+		}
+	}
+
+	var err error
+
+	p.multiline, err = newMultiline(cfg.Multiline)
+	if err != nil {
+		return nil, fmt.Errorf("LogFile %s %v", cfg.Path, err)
+	}
+
+	// the record is held between checks until the flush timeout
+	needState := p.multiline != nil && p.multiline.flushTimeout > 0
+
+	for _, filter := range p.filters {
+		if filter.ContextBefore > p.contextSize {
+			p.contextSize = filter.ContextBefore
+		}
+		if filter.Threshold != nil || filter.Absence != nil || filter.Cooldown > 0 || filter.ContextAfter > 0 {
+			needState = true
+		}
+	}
+
+	if needState {
+		p.stateFilePath, err = stateFilePath(fmt.Sprintf("processor:%s:%s:%s", cfg.Type, cfg.Name, cfg.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		if err = readState(p.stateFilePath, &p.state); err != nil {
+			return nil, fmt.Errorf("LogFile %s processor state error: %v", cfg.Path, err)
+		}
+
+		p.restorePending()
+
+		if p.multiline != nil && p.state.Multiline != nil {
+			p.multiline.restore(*p.state.Multiline)
+		}
+		p.state.Multiline = nil
+	}
+
+	p.dateReg, err = regexp.Compile(cfg.DateFormat)
+	if err != nil {
+		return nil, fmt.Errorf("LogFile %s date pattern compile error: %v", cfg.Path, err)
+	}
+
+	p.normalizer, err = newNormalizer(cfg.Normalize)
+	if err != nil {
+		return nil, fmt.Errorf("LogFile %s %v", cfg.Path, err)
+	}
+
+	return p, nil
+}
+
+// Record is a log entry with the fields provided by the log source
+type Record struct {
+	Text   string
+	Fields map[string]string
+	// the time the record is received by the streaming source or logged,
+	// zero for the records read at the check
+	Time time.Time
+}
+
+type match struct {
+	// the first matched line without date
+	text     string
+	key      string
+	groupKey string
+	count    int
+	lines    []string
+	fields   map[string]string
+	before   []string
+	after    []string
+	need     int
+	// the first and last matched record time
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+func (p *Processor) processLines(lines []string) []Message {
+	records := make([]Record, 0, len(lines))
+	for _, line := range lines {
+		records = append(records, Record{Text: line})
+	}
+	return p.processRecords(records)
+}
+
+// processRecords returns the messages of the records matched by the filters.
+// The changes of the filters state are committed by sendMessages
+// after the messages are sent and rolled back if they are not
+func (p *Processor) processRecords(records []Record) []Message {
+	p.begin()
+
+	now := time.Now()
+
+	if p.multiline != nil {
+		held := p.multiline.pending != nil
+		records = p.multiline.assemble(records, now)
+		if held || p.multiline.pending != nil {
+			p.stateChanged = true
+		}
+	}
+
+	if p.format != "" && p.format != FormatPlain {
+		for i := range records {
+			records[i] = parseFields(p.format, records[i])
+		}
+	}
+
+	texts := make([]string, len(records))
+	for i, record := range records {
+		texts[i] = record.Text
+	}
+
+	// the messages of the previous check are completed with the first lines
+	messages := p.completePending(texts)
+
+	// the lines of the previous checks followed by the current ones
+	history := append(append(make([]string, 0, len(p.context)+len(texts)), p.context...), texts...)
+
+	matchMaps := make([]map[string]*match, len(p.filters))
+
+	for fIndex, filter := range p.filters {
+		matchMaps[fIndex] = make(map[string]*match)
+		for i, record := range records {
+			if record, ok := filter.Match(record); ok {
+				line, _ := lineRemoveDate(record.Text, p.dateReg)
+
+				key := line
+				if p.normalizer != nil {
+					key = p.normalizer.normalize(line)
+				}
+
+				groupKey := ""
+				if len(filter.GroupBy) > 0 {
+					groupKey = filter.groupKey(record)
+					key = groupKey
+				}
+
+				if _, ok := matchMaps[fIndex][key]; !ok {
+					m := &match{text: line, key: key, groupKey: groupKey, fields: record.Fields}
+
+					// the context of the first record
+					if filter.ContextBefore > 0 {
+						end := len(p.context) + i
+						start := end - filter.ContextBefore
+						if start < 0 {
+							start = 0
+						}
+						m.before = append([]string(nil), history[start:end]...)
+					}
+
+					if filter.ContextAfter > 0 {
+						end := i + 1 + filter.ContextAfter
+						if end > len(texts) {
+							end = len(texts)
+						}
+						m.after = append([]string(nil), texts[i+1:end]...)
+						m.need = filter.ContextAfter - len(m.after)
+					}
+
+					matchMaps[fIndex][key] = m
+				}
+
+				m := matchMaps[fIndex][key]
+				m.count++
+
+				seen := record.Time
+				if seen.IsZero() {
+					seen = now
+				}
+				if m.firstSeen.IsZero() || seen.Before(m.firstSeen) {
+					m.firstSeen = seen
+				}
+				if seen.After(m.lastSeen) {
+					m.lastSeen = seen
+				}
+
+				if len(m.lines) < maxMessageLines {
+					m.lines = append(m.lines, record.Text)
+				}
+			}
+		}
+	}
+
+	for fIndex, filter := range p.filters {
+		filterMessages := make([]pendingMessage, 0, len(matchMaps[fIndex]))
+
+		for _, m := range matchMaps[fIndex] {
+			msg := Message{
+				FileName:      p.fileName,
+				FilePath:      p.filePath,
+				Text:          m.text,
+				Count:         m.count,
+				FirstSeen:     m.firstSeen,
+				LastSeen:      m.lastSeen,
+				Lines:         m.lines,
+				ContextBefore: m.before,
+				ContextAfter:  m.after,
+				Fields:        m.fields,
+				Key:           m.key,
+				GroupKey:      m.groupKey,
+				Filter:        filter,
+			}
+
+			filterMessages = append(filterMessages, pendingMessage{msg, m.need})
+		}
+
+		if filter.Threshold != nil {
+			filterMessages = p.applyThreshold(filter, filterMessages, now)
+		}
+
+		if filter.Absence != nil {
+			filterMessages = p.applyAbsence(filter, filterMessages, len(records) > 0, now)
+		}
+
+		if filter.Cooldown > 0 {
+			filterMessages = p.applyCooldown(filter, filterMessages, now)
+		}
+
+		for _, pending := range filterMessages {
+			if pending.need > 0 {
+				p.pending = append(p.pending, pending)
+				p.stateChanged = true
+				continue
+			}
+
+			messages = append(messages, pending.msg)
+		}
+	}
+
+	if p.contextSize > 0 {
+		if len(history) > p.contextSize {
+			history = history[len(history)-p.contextSize:]
+		}
+		p.context = append(p.context[:0], history...)
+	}
+
+	return messages
+}
+
+// applyThreshold counts the filter matches in the threshold window per group key.
+// Returns the firing message with the number of matches in the window when the threshold
+// is reached, and the resolved message when it is not reached within the whole window
+func (p *Processor) applyThreshold(filter *Filter, messages []pendingMessage, now time.Time) []pendingMessage {
+	groups := make(map[string][]pendingMessage)
+	for _, pending := range messages {
+		groups[pending.msg.GroupKey] = append(groups[pending.msg.GroupKey], pending)
+	}
+
+	// the groups without matches are counted too, the window slides
+	for key := range p.state.Thresholds {
+		if groupKey, ok := alertGroupKey(key, filter.Name); ok {
+			if _, ok := groups[groupKey]; !ok {
+				groups[groupKey] = nil
+			}
+		}
+	}
+
+	if p.state.Thresholds == nil {
+		p.state.Thresholds = make(map[string]*thresholdState)
+	}
+
+	var result []pendingMessage
+
+	for groupKey, groupMessages := range groups {
+		key := alertKey(filter.Name, groupKey)
+
+		count := 0
+		for _, pending := range groupMessages {
+			count += pending.msg.Count
+		}
+
+		state, ok := p.state.Thresholds[key]
+		if !ok {
+			state = &thresholdState{}
+			p.state.Thresholds[key] = state
+		}
+
+		// the window can be reached without matches, e.g. the threshold count is lowered
+		// after restart, the counts are kept then until the matched line of the new alert
+		var buckets []thresholdBucket
+		if len(groupMessages) == 0 {
+			buckets = append(buckets, state.Buckets...)
+		}
+
+		total, windowStart, reached := filter.Threshold.add(state, count, now)
+
+		if count > 0 || reached {
+			p.stateChanged = true
+		}
+
+		if reached {
+			alert, alertFiring := p.state.Alerts[key]
+
+			var firing pendingMessage
+
+			switch {
+			case len(groupMessages) > 0:
+				// the most frequent line is the message text
+				firing = groupMessages[0]
+				for _, pending := range groupMessages[1:] {
+					if pending.msg.Count > firing.msg.Count {
+						firing = pending
+					}
+				}
+			case alertFiring:
+				firing.msg = Message{
+					FileName: p.fileName,
+					FilePath: p.filePath,
+					Text:     alert.Text,
+					Fields:   alert.Fields,
+					LastSeen: now,
+					GroupKey: groupKey,
+					Filter:   filter,
+				}
+			default:
+				state.Buckets, state.Fired = buckets, false
+				continue
+			}
+
+			state.LastReached = now
+
+			firing.msg.Count = total
+			firing.msg.FirstSeen = windowStart
+
+			if p.startAlert(key, &firing.msg, now) || p.repeatAlert(key, &firing.msg, filter.RepeatInterval, now) {
+				result = append(result, firing)
+			}
+
+			continue
+		}
+
+		if _, firing := p.state.Alerts[key]; firing && now.Sub(state.LastReached) >= filter.Threshold.window {
+			msg := Message{
+				FileName: p.fileName,
+				FilePath: p.filePath,
+				Count:    total,
+				LastSeen: now,
+				GroupKey: groupKey,
+				Filter:   filter,
+			}
+
+			alert := p.resolveAlert(key, &msg)
+			msg.Text, msg.Fields, msg.FirstSeen = alert.Text, alert.Fields, alert.Since
+
+			result = append(result, pendingMessage{msg: msg})
+		}
+
+		// the state of the inactive group is not kept
+		if _, firing := p.state.Alerts[key]; !firing && total == 0 {
+			delete(p.state.Thresholds, key)
+		}
+	}
+
+	return result
+}
+
+// applyAbsence tracks the last filter activity, the matched records or the log source
+// modification. Returns the absence message when the records stop appearing
+// and the resolved message when they appear again
+func (p *Processor) applyAbsence(filter *Filter, messages []pendingMessage, hasRecords bool, now time.Time) []pendingMessage {
+	var lastSeen time.Time
+
+	if filter.Absence.modTime {
+		lastSeen = p.modTime
+		if hasRecords {
+			lastSeen = now
+		}
+	} else if len(messages) > 0 {
+		lastSeen = now
+	}
+
+	if p.state.Absences == nil {
+		p.state.Absences = make(map[string]*absenceState)
+	}
+
+	state, ok := p.state.Absences[filter.Name]
+	if !ok {
+		state = &absenceState{}
+		p.state.Absences[filter.Name] = state
+	}
+
+	prevState := *state
+	prevLastSeen := state.LastSeen
+
+	fire, resolve := filter.Absence.check(state, lastSeen, now)
+
+	if *state != prevState {
+		p.stateChanged = true
+	}
+
+	key := alertKey(filter.Name, "")
+
+	switch {
+	case fire || state.Firing:
+		text := "No matching records since %s"
+		if filter.Absence.modTime {
+			text = "No new records since %s"
+		}
+
+		msg := Message{
+			FileName:  p.fileName,
+			FilePath:  p.filePath,
+			Text:      fmt.Sprintf(text, state.LastSeen.Format("2006-01-02 15:04:05")),
+			FirstSeen: state.LastSeen,
+			LastSeen:  now,
+			Filter:    filter,
+		}
+
+		if p.startAlert(key, &msg, now) || p.repeatAlert(key, &msg, filter.RepeatInterval, now) {
+			return []pendingMessage{{msg: msg}}
+		}
+	case resolve && len(messages) > 0:
+		messages = messages[:1]
+		p.resolveAlert(key, &messages[0].msg)
+		messages[0].msg.Resolved = true
+		messages[0].msg.FirstSeen = prevLastSeen
+		return messages
+	case resolve:
+		msg := Message{
+			FileName:  p.fileName,
+			FilePath:  p.filePath,
+			Text:      fmt.Sprintf("New records after %s", prevLastSeen.Format("2006-01-02 15:04:05")),
+			FirstSeen: prevLastSeen,
+			LastSeen:  now,
+			Resolved:  true,
+			Filter:    filter,
+		}
+		p.resolveAlert(key, &msg)
+		return []pendingMessage{{msg: msg}}
+	}
+
+	return nil
+}
+
+// setModTime sets the log source modification time for the absence filters
+func (p *Processor) setModTime(modTime time.Time) {
+	p.modTime = modTime
+}
+
+// begin saves the processor state before the records processing.
+// The state of several processings without sending is committed together
+func (p *Processor) begin() {
+	if p.snapshot != nil {
+		return
+	}
+
+	p.snapshot = &processorSnapshot{
+		state:        p.state.clone(),
+		stateChanged: p.stateChanged,
+		context:      append([]string(nil), p.context...),
+		pending:      append([]pendingMessage(nil), p.pending...),
+	}
+
+	if p.multiline != nil {
+		p.snapshot.multiline = p.multiline.state()
+	}
+}
+
+// commit saves the processor state after the messages are sent
+func (p *Processor) commit() {
+	p.snapshot = nil
+	p.saveState()
+}
+
+// rollback restores the processor state after the messages sending failure
+func (p *Processor) rollback() {
+	if p.snapshot == nil {
+		return
+	}
+
+	p.state = p.snapshot.state
+	p.stateChanged = p.snapshot.stateChanged
+	p.context = p.snapshot.context
+	p.pending = p.snapshot.pending
+	if p.multiline != nil {
+		p.multiline.restore(p.snapshot.multiline)
+	}
+	p.snapshot = nil
+}
+
+// clone returns the deep copy of the state
+func (s ProcessorState) clone() ProcessorState {
+	var state ProcessorState
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		log.Printf("[ERROR] processor state copy error: %v", err)
+		return state
+	}
+
+	if err = json.Unmarshal(b, &state); err != nil {
+		log.Printf("[ERROR] processor state copy error: %v", err)
+	}
+
+	return state
+}
+
+func (p *Processor) saveState() {
+	if !p.stateChanged || p.stateFilePath == "" {
+		return
+	}
+
+	state := p.state
+	for _, pending := range p.pending {
+		state.Pending = append(state.Pending, pendingState{pending.msg.Filter.Name, pending.msg, pending.need})
+	}
+
+	if p.multiline != nil && p.multiline.pending != nil {
+		multiline := p.multiline.state()
+		state.Multiline = &multiline
+	}
+
+	if err := writeState(p.stateFilePath, state); err != nil {
+		log.Printf("[ERROR] processor state update error: %v log file: %s", err, p.filePath)
+		return
+	}
+
+	p.stateChanged = false
+}
+
+func (p *Processor) removeState() error {
+	if p.stateFilePath == "" {
+		return nil
+	}
+
+	err := os.Remove(p.stateFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// completePending adds the context after lines to the messages waiting for them.
+// The messages wait for one check only, so they are returned even if the lines are not enough
+func (p *Processor) completePending(texts []string) []Message {
+	if len(p.pending) == 0 {
+		return nil
+	}
+
+	messages := make([]Message, 0, len(p.pending))
+
+	for _, pending := range p.pending {
+		need := pending.need
+		if need > len(texts) {
+			need = len(texts)
+		}
+
+		msg := pending.msg
+		msg.ContextAfter = append(msg.ContextAfter, texts[:need]...)
+
+		messages = append(messages, msg)
+	}
+
+	p.pending = nil
+	p.stateChanged = true
+
+	return messages
+}
+
+// restorePending restores the pending messages of the persisted state,
+// the messages of the removed filters are dropped
+func (p *Processor) restorePending() {
+	for _, pending := range p.state.Pending {
+		for _, filter := range p.filters {
+			if filter.Name == pending.Filter {
+				pending.Message.Filter = filter
+				p.pending = append(p.pending, pendingMessage{pending.Message, pending.Need})
+				break
+			}
+		}
+	}
+
+	p.state.Pending = nil
+}
+
+// sendMessages sends the messages and commits the processor state,
+// the state is rolled back if a message is not sent.
+// The messages sent to the notifiers before the failure are skipped on the next send
+func (p *Processor) sendMessages(ctx context.Context, messages []Message) error {
+	for _, msg := range messages {
+		for _, notifier := range msg.Filter.Notifiers {
+			key := msg.deliveryKey(notifier.Name())
+
+			ref, ok := p.delivered[key]
+			if !ok {
+				var err error
+
+				ref, err = notifier.Send(ctx, msg)
+				if err != nil {
+					p.rollback()
+					return fmt.Errorf("%s message send error: %v msg: %s", notifier.Type(), err, msg.Text)
+				}
+
+				if p.delivered == nil {
+					p.delivered = make(map[string]string)
+				}
+				p.delivered[key] = ref
+
+				if msg.AlertID != "" && !msg.Resolved && msg.Repeat == 0 {
+					if p.deliveredAlerts == nil {
+						p.deliveredAlerts = make(map[string]string)
+					}
+					p.deliveredAlerts[alertKey(msg.Filter.Name, msg.GroupKey)] = msg.AlertID
+				}
+			}
+
+			// the first firing message reference for the repeated and resolved messages
+			if msg.AlertID != "" && !msg.Resolved && msg.Repeat == 0 && ref != "" {
+				msg.Refs[notifier.Name()] = ref
+				p.stateChanged = true
+			}
+		}
+	}
+
+	p.delivered, p.deliveredAlerts = nil, nil
+	p.commit()
+
+	return nil
+}
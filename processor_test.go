@@ -0,0 +1,602 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestProcessorCaptureFields(t *testing.T) {
+	lines := []string{
+		"2023-10-12 10:15:25 ERROR login failed user=alice ip=10.0.0.1",
+		"2023-10-12 10:15:26 ERROR login failed user=bob ip=10.0.0.2",
+		"2023-10-12 10:15:27 ERROR login failed user=alice ip=10.0.0.3",
+		"2023-10-12 10:15:28 INFO login user=alice ip=10.0.0.3",
+	}
+
+	type result struct {
+		text   string
+		count  int
+		fields map[string]string
+	}
+
+	tests := []struct {
+		name     string
+		cfg      FilterConfig
+		expected []result
+	}{
+		{
+			"1. Named captures",
+			FilterConfig{Pattern: `ERROR login failed user=(?P<user>\w+) ip=%{IPV4:client.ip}`},
+			[]result{
+				{"ERROR login failed user=alice ip=10.0.0.1", 1, map[string]string{"user": "alice", "client.ip": "10.0.0.1"}},
+				{"ERROR login failed user=alice ip=10.0.0.3", 1, map[string]string{"user": "alice", "client.ip": "10.0.0.3"}},
+				{"ERROR login failed user=bob ip=10.0.0.2", 1, map[string]string{"user": "bob", "client.ip": "10.0.0.2"}},
+			},
+		},
+		{
+			"2. Group by capture",
+			FilterConfig{Pattern: `ERROR login failed user=(?P<user>\w+)`, GroupBy: []string{"user"}},
+			[]result{
+				{"ERROR login failed user=alice ip=10.0.0.1", 2, map[string]string{"user": "alice"}},
+				{"ERROR login failed user=bob ip=10.0.0.2", 1, map[string]string{"user": "bob"}},
+			},
+		},
+		{
+			"3. Group by missing field",
+			FilterConfig{Pattern: `login`, GroupBy: []string{"user"}},
+			[]result{
+				{"ERROR login failed user=alice ip=10.0.0.1", 4, nil},
+			},
+		},
+	}
+
+	grok, err := NewGrok(GrokConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Name = "test"
+			filter, err := NewFilter(tt.cfg, "host", nil, grok)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			processor, err := NewProcessor(FileConfig{
+				Path:       "/tmp/test",
+				DateFormat: `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} `,
+				Filters:    []string{"test"},
+			}, []*Filter{filter})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var results []result
+			for _, msg := range processor.processLines(lines) {
+				results = append(results, result{msg.Text, msg.Count, msg.Fields})
+			}
+
+			sort.Slice(results, func(i, j int) bool { return results[i].text < results[j].text })
+
+			if !reflect.DeepEqual(results, tt.expected) {
+				t.Errorf("got %v, expected %v", results, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProcessorContext(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{Name: "test", Pattern: "ERROR", ContextBefore: 2, ContextAfter: 2}, "host", nil, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor, err := NewProcessor(FileConfig{Path: "/tmp/test", Filters: []string{"test"}}, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	type result struct {
+		text   string
+		before []string
+		after  []string
+	}
+
+	checks := []struct {
+		lines    []string
+		expected []result
+	}{
+		{
+			[]string{"a", "b", "c", "ERROR 1", "d", "e", "f"},
+			[]result{{"ERROR 1", []string{"b", "c"}, []string{"d", "e"}}},
+		},
+		{
+			[]string{"ERROR 2", "g"},
+			nil,
+		},
+		{
+			[]string{"h", "i"},
+			[]result{{"ERROR 2", []string{"e", "f"}, []string{"g", "h"}}},
+		},
+		{
+			[]string{"j", "ERROR 3"},
+			nil,
+		},
+		{
+			// the pending message waits for one check only
+			nil,
+			[]result{{"ERROR 3", []string{"i", "j"}, nil}},
+		},
+	}
+
+	for i, check := range checks {
+		var results []result
+		for _, msg := range processor.processLines(check.lines) {
+			results = append(results, result{msg.Text, msg.ContextBefore, msg.ContextAfter})
+		}
+
+		if !reflect.DeepEqual(results, check.expected) {
+			t.Errorf("check %d: got %v, expected %v", i+1, results, check.expected)
+		}
+	}
+}
+
+func TestProcessorPendingState(t *testing.T) {
+	notifier := &testNotifier{}
+
+	filter, err := NewFilter(FilterConfig{
+		Name:          "test",
+		Pattern:       "ERROR",
+		ContextAfter:  2,
+		Notifications: []string{"test"},
+	}, "host", []Notifier{notifier}, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := FileConfig{Name: "pending_test", Path: "/tmp/pending_test", Filters: []string{"test"}}
+
+	processor, err := NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	messages := processor.processLines([]string{"ERROR 1", "a"})
+	if err := processor.sendMessages(context.Background(), messages); err != nil || len(messages) != 0 {
+		t.Fatalf("unexpected messages: %v, error: %v", messages, err)
+	}
+
+	// the pending message is restored after restart
+	processor, err = NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pending message is kept after the failed send
+	notifier.err = fmt.Errorf("connection refused")
+
+	for i := 0; i < 2; i++ {
+		messages = processor.processLines([]string{"b", "c"})
+		if len(messages) != 1 || !reflect.DeepEqual(messages[0].ContextAfter, []string{"a", "b"}) {
+			t.Fatalf("%d. unexpected messages: %v", i, messages)
+		}
+
+		if err := processor.sendMessages(context.Background(), messages); err == nil {
+			t.Fatalf("%d. expected send error", i)
+		}
+
+		if len(processor.pending) != 1 {
+			t.Fatalf("%d. expected pending message, got %v", i, processor.pending)
+		}
+	}
+
+	notifier.err = nil
+
+	messages = processor.processLines([]string{"b", "c"})
+	if err := processor.sendMessages(context.Background(), messages); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notifier.sent) != 1 || notifier.sent[0].Text != "ERROR 1" || len(processor.pending) != 0 {
+		t.Errorf("unexpected sent messages: %v", notifier.sent)
+	}
+}
+
+func TestProcessorThresholdState(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{
+		Name:      "test",
+		Pattern:   "timeout",
+		Threshold: ThresholdConfig{Count: 3, WindowSec: 600},
+	}, "host", nil, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := FileConfig{Name: "threshold_test", Path: "/tmp/threshold_test", Filters: []string{"test"}}
+
+	processor, err := NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	if messages := processor.processLines([]string{"timeout a", "timeout b"}); len(messages) != 0 {
+		t.Fatalf("unexpected messages: %v", messages)
+	}
+
+	if err := processor.sendMessages(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the counts are restored after restart
+	processor, err = NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := processor.processLines([]string{"ok", "timeout b"})
+	if len(messages) != 1 || messages[0].Count != 3 || messages[0].Text != "timeout b" {
+		t.Fatalf("unexpected messages: %v", messages)
+	}
+
+	if messages := processor.processLines([]string{"timeout c"}); len(messages) != 0 {
+		t.Fatalf("unexpected messages after threshold reset: %v", messages)
+	}
+}
+
+func TestProcessorThresholdCountLowered(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{
+		Name:              "test",
+		Pattern:           "timeout",
+		Threshold:         ThresholdConfig{Count: 30, WindowSec: 600},
+		RepeatIntervalSec: 60,
+	}, "host", nil, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor, err := NewProcessor(FileConfig{Name: "threshold_lowered_test", Path: "/tmp/threshold_lowered_test", Filters: []string{"test"}}, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the counts persisted with the higher threshold count reach the window without matches
+	now := time.Now()
+	processor.state.Thresholds = map[string]*thresholdState{
+		"test": {Buckets: []thresholdBucket{{now.Add(-time.Minute).Unix(), 40}}},
+	}
+
+	if messages := processor.processRecords(nil); len(messages) != 0 {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+
+	messages := processor.processLines([]string{"timeout a"})
+	if len(messages) != 1 || messages[0].Count != 41 || messages[0].Text != "timeout a" {
+		t.Fatalf("expected firing message, got %+v", messages)
+	}
+
+	// the firing alert is repeated with its text
+	processor.state.Thresholds["test"].Buckets = []thresholdBucket{{now.Add(-time.Minute).Unix(), 40}}
+	processor.state.Alerts["test"].Notified = now.Add(-time.Hour)
+
+	messages = processor.processRecords(nil)
+	if len(messages) != 1 || messages[0].Repeat != 1 || messages[0].Text != "timeout a" {
+		t.Fatalf("expected repeated firing message, got %+v", messages)
+	}
+}
+
+func TestProcessorAbsence(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{
+		Name:           "backup",
+		Type:           FilterTypeAbsence,
+		Pattern:        "backup completed",
+		ExpectEverySec: 3600,
+	}, "host", nil, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor, err := NewProcessor(FileConfig{Name: "absence_test", Path: "/tmp/absence_test", Filters: []string{"backup"}}, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	if messages := processor.processLines([]string{"backup started"}); len(messages) != 0 {
+		t.Fatalf("unexpected messages: %v", messages)
+	}
+
+	processor.state.Absences["backup"].LastSeen = time.Now().Add(-2 * time.Hour)
+
+	messages := processor.processLines([]string{"backup started"})
+	if len(messages) != 1 || messages[0].Resolved || messages[0].Count != 0 {
+		t.Fatalf("expected absence message, got %v", messages)
+	}
+
+	messages = processor.processLines([]string{"backup started", "backup completed"})
+	if len(messages) != 1 || !messages[0].Resolved || messages[0].Text != "backup completed" {
+		t.Fatalf("expected resolved message, got %v", messages)
+	}
+}
+
+type testNotifier struct {
+	name string
+	sent []Message
+	err  error
+}
+
+func (tn *testNotifier) Name() string {
+	if tn.name != "" {
+		return tn.name
+	}
+	return "test"
+}
+
+func (tn *testNotifier) Type() string              { return "test" }
+func (tn *testNotifier) Render(msg *Message) error { return msg.Render("test", Templates{}, nil) }
+func (tn *testNotifier) Close() error              { return nil }
+
+func (tn *testNotifier) Send(ctx context.Context, msg Message) (string, error) {
+	if tn.err != nil {
+		return "", tn.err
+	}
+	tn.sent = append(tn.sent, msg)
+	return fmt.Sprintf("ref-%d", len(tn.sent)), nil
+}
+
+func TestProcessorAlertLifecycle(t *testing.T) {
+	notifier := &testNotifier{}
+
+	filter, err := NewFilter(FilterConfig{
+		Name:          "timeouts",
+		Pattern:       `timeout user=(?P<user>\w+)`,
+		GroupBy:       []string{"user"},
+		Threshold:     ThresholdConfig{Count: 2, WindowSec: 60},
+		Notifications: []string{"test"},
+	}, "host", []Notifier{notifier}, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := FileConfig{Name: "lifecycle_test", Path: "/tmp/lifecycle_test", Filters: []string{"timeouts"}}
+
+	processor, err := NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	process := func(lines ...string) []Message {
+		messages := processor.processLines(lines)
+		if err := processor.sendMessages(context.Background(), messages); err != nil {
+			t.Fatal(err)
+		}
+		return messages
+	}
+
+	messages := process("timeout user=alice", "timeout user=alice", "timeout user=bob")
+	if len(messages) != 1 || messages[0].AlertID == "" || messages[0].Fields["user"] != "alice" {
+		t.Fatalf("expected alice firing message, got %v", messages)
+	}
+
+	firing := messages[0]
+
+	// the alert is already firing
+	if messages := process("timeout user=alice", "timeout user=alice"); len(messages) != 0 {
+		t.Fatalf("unexpected messages: %v", messages)
+	}
+
+	// the alerts are restored after restart
+	processor, err = NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := process(); len(messages) != 0 {
+		t.Fatalf("unexpected messages within the window: %v", messages)
+	}
+
+	processor.state.Thresholds[alertKey("timeouts", "alice")].LastReached = time.Now().Add(-time.Minute)
+
+	messages = process()
+	if len(messages) != 1 {
+		t.Fatalf("expected resolved message, got %v", messages)
+	}
+
+	resolved := messages[0]
+
+	if !resolved.Resolved || resolved.AlertID != firing.AlertID || resolved.Text != firing.Text ||
+		resolved.Refs["test"] != "ref-1" || resolved.Fields["user"] != "alice" {
+		t.Errorf("unexpected resolved message: %+v", resolved)
+	}
+
+	if len(processor.state.Alerts) != 0 {
+		t.Errorf("unexpected alerts: %v", processor.state.Alerts)
+	}
+}
+
+func TestProcessorRollback(t *testing.T) {
+	notifier := &testNotifier{err: fmt.Errorf("connection refused")}
+
+	filter, err := NewFilter(FilterConfig{
+		Name:          "timeouts",
+		Pattern:       `timeout`,
+		Threshold:     ThresholdConfig{Count: 3, WindowSec: 60},
+		Notifications: []string{"test"},
+	}, "host", []Notifier{notifier}, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := FileConfig{Name: "rollback_test", Path: "/tmp/rollback_test", Filters: []string{"timeouts"}}
+
+	processor, err := NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	lines := []string{"timeout", "timeout", "timeout"}
+
+	// the lines are processed again after the failed send, they are counted once
+	for i := 0; i < 2; i++ {
+		messages := processor.processLines(lines)
+		if len(messages) != 1 || messages[0].Count != 3 {
+			t.Fatalf("%d. expected firing message, got %v", i, messages)
+		}
+
+		if err := processor.sendMessages(context.Background(), messages); err == nil {
+			t.Fatalf("%d. expected send error", i)
+		}
+
+		if len(processor.state.Alerts) != 0 || len(processor.state.Thresholds) != 0 {
+			t.Fatalf("%d. unexpected state after failed send: %+v", i, processor.state)
+		}
+	}
+
+	notifier.err = nil
+
+	messages := processor.processLines(lines)
+	if err := processor.sendMessages(context.Background(), messages); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notifier.sent) != 1 || len(processor.state.Alerts) != 1 {
+		t.Fatalf("expected sent firing message, got %v, alerts: %v", notifier.sent, processor.state.Alerts)
+	}
+
+	// the committed state is restored after restart
+	processor, err = NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alert := processor.state.Alerts[alertKey("timeouts", "")]; alert == nil || alert.Refs["test"] != "ref-1" {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+}
+
+func TestProcessorAlertNotSent(t *testing.T) {
+	notifier := &testNotifier{err: fmt.Errorf("connection refused")}
+
+	filter, err := NewFilter(FilterConfig{
+		Name:          "timeouts",
+		Pattern:       `timeout`,
+		Threshold:     ThresholdConfig{Count: 1, WindowSec: 60},
+		Notifications: []string{"test"},
+	}, "host", []Notifier{notifier}, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := FileConfig{Name: "alert_not_sent_test", Path: "/tmp/alert_not_sent_test", Filters: []string{"timeouts"}}
+
+	processor, err := NewProcessor(cfg, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	messages := processor.processLines([]string{"timeout"})
+	if err := processor.sendMessages(context.Background(), messages); err == nil {
+		t.Fatal("expected send error")
+	}
+
+	notifier.err = nil
+
+	// the alert of the not sent firing message is not resolved
+	if messages := processor.processLines(nil); len(messages) != 0 {
+		t.Fatalf("unexpected messages: %v", messages)
+	}
+
+	// the next match starts the alert
+	messages = processor.processLines([]string{"timeout"})
+	if len(messages) != 1 || messages[0].AlertID == "" || messages[0].Resolved {
+		t.Fatalf("expected firing message, got %v", messages)
+	}
+}
+
+func TestProcessorPartialSend(t *testing.T) {
+	mail := &testNotifier{name: "mail"}
+	tg := &testNotifier{name: "tg", err: fmt.Errorf("connection refused")}
+
+	filter, err := NewFilter(FilterConfig{
+		Name:          "errors",
+		Pattern:       `ERROR`,
+		Threshold:     ThresholdConfig{Count: 1, WindowSec: 60},
+		Notifications: []string{"mail", "tg"},
+	}, "host", []Notifier{mail, tg}, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor, err := NewProcessor(FileConfig{Name: "partial_test", Path: "/tmp/partial_test", Filters: []string{"errors"}}, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.removeState()
+
+	lines := []string{"ERROR disk full"}
+
+	if err := processor.sendMessages(context.Background(), processor.processLines(lines)); err == nil {
+		t.Fatal("expected send error")
+	}
+
+	tg.err = nil
+
+	// the records are processed again, the message is sent to the failed notifier only
+	if err := processor.sendMessages(context.Background(), processor.processLines(lines)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mail.sent) != 1 || len(tg.sent) != 1 {
+		t.Fatalf("expected one message per notifier, got %v, %v", mail.sent, tg.sent)
+	}
+
+	// the reference and the alert ID of the message sent before the failure are kept
+	alert := processor.state.Alerts[alertKey("errors", "")]
+	if alert == nil || alert.Refs["mail"] != "ref-1" || alert.Refs["tg"] != "ref-1" {
+		t.Fatalf("unexpected alert: %+v", alert)
+	}
+
+	if mail.sent[0].AlertID != alert.ID || tg.sent[0].AlertID != alert.ID {
+		t.Errorf("expected alert ID %s, got %s, %s", alert.ID, mail.sent[0].AlertID, tg.sent[0].AlertID)
+	}
+}
+
+func TestProcessorSeenTime(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{Name: "errors", Pattern: `ERROR`}, "host", nil, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor, err := NewProcessor(FileConfig{Name: "seen_test", Path: "/tmp/seen_test", Filters: []string{"errors"}}, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := time.Date(2023, 10, 12, 10, 15, 25, 0, time.UTC)
+	last := first.Add(time.Minute)
+
+	// the streamed records are aggregated in the order they are received
+	messages := processor.processRecords([]Record{
+		{Text: "ERROR disk full", Time: first.Add(time.Second)},
+		{Text: "ERROR disk full", Time: last},
+		{Text: "ERROR disk full", Time: first},
+	})
+
+	if len(messages) != 1 || messages[0].Count != 3 {
+		t.Fatalf("expected 1 message, got %+v", messages)
+	}
+
+	if !messages[0].FirstSeen.Equal(first) || !messages[0].LastSeen.Equal(last) {
+		t.Errorf("expected %v - %v, got %v - %v", first, last, messages[0].FirstSeen, messages[0].LastSeen)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	RotationNumeric = "numeric"
+	RotationDateExt = "dateext"
+	RotationGlob    = "glob"
+)
+
+const defaultRotationDepth = 3
+
+type RotationConfig struct {
+	Scheme       string `yaml:"scheme"`
+	Pattern      string `yaml:"pattern"`
+	Depth        int    `yaml:"depth"`
+	CopyTruncate bool   `yaml:"copyTruncate"`
+}
+
+// Rotation searches for the rotated files of the log file
+type Rotation struct {
+	scheme       string
+	pattern      string
+	depth        int
+	copyTruncate bool
+}
+
+func NewRotation(cfg RotationConfig, filePath string) (*Rotation, error) {
+	r := &Rotation{
+		scheme:       cfg.Scheme,
+		pattern:      cfg.Pattern,
+		depth:        cfg.Depth,
+		copyTruncate: cfg.CopyTruncate,
+	}
+
+	if r.depth == 0 {
+		r.depth = defaultRotationDepth
+	}
+
+	if r.depth < 0 {
+		return nil, fmt.Errorf("LogFile %s rotation depth %d is negative", filePath, r.depth)
+	}
+
+	switch r.scheme {
+	case "", RotationNumeric:
+		r.scheme = RotationNumeric
+	case RotationDateExt:
+		r.pattern = filePath + "-*"
+	case RotationGlob:
+		if r.pattern == "" {
+			return nil, fmt.Errorf("LogFile %s rotation pattern is empty", filePath)
+		}
+	default:
+		return nil, fmt.Errorf("LogFile %s rotation scheme '%s' is unsupported", filePath, r.scheme)
+	}
+
+	if _, err := filepath.Match(r.pattern, ""); err != nil {
+		return nil, fmt.Errorf("LogFile %s rotation pattern error: %v", filePath, err)
+	}
+
+	return r, nil
+}
+
+// files returns the log file path followed by the paths of existing rotated files
+// ordered from the newest to the oldest
+func (r *Rotation) files(filePath string) []string {
+	paths := []string{filePath}
+
+	if r.scheme == RotationNumeric {
+		for i := 1; i <= r.depth; i++ {
+			path := fmt.Sprintf("%s.%d", filePath, i)
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+				continue
+			}
+
+			// the rotated file may be already compressed
+			for _, ext := range compressedExts {
+				if _, err := os.Stat(path + ext); err == nil {
+					paths = append(paths, path+ext)
+					break
+				}
+			}
+		}
+		return paths
+	}
+
+	matches, _ := filepath.Glob(r.pattern)
+
+	type rotatedFile struct {
+		path    string
+		modTime int64
+	}
+
+	rotated := make([]rotatedFile, 0, len(matches))
+
+	for _, path := range matches {
+		if path == filePath {
+			continue
+		}
+
+		fInfo, err := os.Stat(path)
+		if err != nil || !fInfo.Mode().IsRegular() {
+			continue
+		}
+
+		rotated = append(rotated, rotatedFile{path, fInfo.ModTime().UnixNano()})
+	}
+
+	sort.SliceStable(rotated, func(i, j int) bool {
+		if rotated[i].modTime == rotated[j].modTime {
+			return rotated[i].path > rotated[j].path
+		}
+		return rotated[i].modTime > rotated[j].modTime
+	})
+
+	for i := 0; i < len(rotated) && i < r.depth; i++ {
+		paths = append(paths, rotated[i].path)
+	}
+
+	return paths
+}
+
+// isRotated reports whether the path is a rotated file of the log file regardless of the depth,
+// e.g. file.4.gz for the numeric scheme
+func (r *Rotation) isRotated(filePath, path string) bool {
+	if path == filePath {
+		return false
+	}
+
+	if r.scheme != RotationNumeric {
+		matched, _ := filepath.Match(r.pattern, path)
+		return matched
+	}
+
+	if !strings.HasPrefix(path, filePath+".") {
+		return false
+	}
+
+	suffix := path[len(filePath)+1:]
+	for _, ext := range compressedExts {
+		suffix = strings.TrimSuffix(suffix, ext)
+	}
+
+	if suffix == "" {
+		return false
+	}
+
+	for _, c := range suffix {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRotationFiles(t *testing.T) {
+	dir := t.TempDir()
+	logFilePath := filepath.Join(dir, "app.log")
+
+	files := []string{
+		"app.log",
+		"app.log.1",
+		"app.log.3",
+		"app.log-20231010",
+		"app.log-20231011",
+		"app.log-20231012",
+		"app.2023-10-11.log",
+		"app.2023-10-12.log",
+	}
+
+	now := time.Now()
+
+	for i, name := range files {
+		path := filepath.Join(dir, name)
+		createFileWithData(path, []byte("data\n"))
+
+		// the later file in the list is the newer one
+		modTime := now.Add(time.Duration(i-len(files)) * time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		cfg      RotationConfig
+		expected []string
+	}{
+		{
+			"1. Numeric with a missing file",
+			RotationConfig{},
+			[]string{"app.log", "app.log.1", "app.log.3"},
+		},
+		{
+			"2. Numeric depth",
+			RotationConfig{Scheme: RotationNumeric, Depth: 1},
+			[]string{"app.log", "app.log.1"},
+		},
+		{
+			"3. Dateext",
+			RotationConfig{Scheme: RotationDateExt, Depth: 2},
+			[]string{"app.log", "app.log-20231012", "app.log-20231011"},
+		},
+		{
+			"4. Custom glob",
+			RotationConfig{Scheme: RotationGlob, Pattern: filepath.Join(dir, "app.*.log")},
+			[]string{"app.log", "app.2023-10-12.log", "app.2023-10-11.log"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rotation, err := NewRotation(tt.cfg, logFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := make([]string, 0, len(tt.expected))
+			for _, name := range tt.expected {
+				expected = append(expected, filepath.Join(dir, name))
+			}
+
+			if paths := rotation.files(logFilePath); !reflect.DeepEqual(paths, expected) {
+				t.Errorf("Expected files %v, received %v", expected, paths)
+			}
+		})
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"html"
 	"net/smtp"
+	"strings"
 	"sync"
 )
 
@@ -17,19 +19,27 @@ type MailConfig struct {
 	Password string `yaml:"password"`
 	From     string `yaml:"from"`
 	To       string `yaml:"to"`
+	HTML     bool   `yaml:"html"`
 }
 
 type SmtpNotifier struct {
 	sync.Mutex
-	name     string
-	hostname string
-	auth     smtp.Auth
-	from     string
-	to       string
-	client   *smtp.Client
+	name      string
+	hostname  string
+	auth      smtp.Auth
+	from      string
+	to        string
+	html      bool
+	templates Templates
+	client    *smtp.Client
 }
 
 func NewSmtpNotifier(cfg NotificationConfig) (*SmtpNotifier, error) {
+	templates, err := NewTemplates(cfg.Name, cfg.TemplateConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	hostname := cfg.MailConfig.Host + ":" + cfg.MailConfig.Port
 
 	client, err := smtp.Dial(hostname)
@@ -64,43 +74,82 @@ func NewSmtpNotifier(cfg NotificationConfig) (*SmtpNotifier, error) {
 		auth,
 		cfg.MailConfig.From,
 		cfg.MailConfig.To,
+		cfg.MailConfig.HTML,
+		templates,
 		client,
 	}, nil
 }
 
-func (sn *SmtpNotifier) Send(ctx context.Context, msg Message) error {
+func (sn *SmtpNotifier) Send(ctx context.Context, msg Message) (string, error) {
 	sn.Lock()
 	defer sn.Unlock()
 
-	msg.BuildSubject()
-	msg.BuildText()
+	if err := sn.Render(&msg); err != nil {
+		return "", err
+	}
 
 	err := sn.client.Mail(sn.from)
 	if err != nil {
-		return fmt.Errorf("SMTP client mail error: %v", err)
+		return "", fmt.Errorf("SMTP client mail error: %v", err)
 	}
 
 	err = sn.client.Rcpt(sn.to)
 	if err != nil {
-		return fmt.Errorf("SMTP client rcpt error: %v", err)
+		return "", fmt.Errorf("SMTP client rcpt error: %v", err)
 	}
 
 	w, err := sn.client.Data()
 	if err != nil {
-		return fmt.Errorf("SMTP client data error: %v", err)
+		return "", fmt.Errorf("SMTP client data error: %v", err)
+	}
+
+	var headers []string
+
+	if sn.html {
+		headers = append(headers, "MIME-Version: 1.0", "Content-Type: text/html; charset=UTF-8")
 	}
 
-	_, err = w.Write(newSmtpMessage(sn.From(), sn.To(), msg.Subject, msg.Text))
+	messageID, alertHeaders := sn.alertHeaders(msg)
+	headers = append(headers, alertHeaders...)
+
+	_, err = w.Write(newSmtpMessage(sn.From(), sn.To(), msg.Subject, msg.Text, headers...))
 	if err != nil {
-		return fmt.Errorf("SMTP client write error: %v", err)
+		return "", fmt.Errorf("SMTP client write error: %v", err)
 	}
 
 	err = w.Close()
 	if err != nil {
-		return fmt.Errorf("SMTP client write close error: %v", err)
+		return "", fmt.Errorf("SMTP client write close error: %v", err)
 	}
 
-	return nil
+	return messageID, nil
+}
+
+// alertHeaders returns the Message-ID of the alert message and its headers.
+// The repeated and resolved messages are the replies to the firing message of the alert
+func (sn *SmtpNotifier) alertHeaders(msg Message) (string, []string) {
+	if msg.AlertID == "" {
+		return "", nil
+	}
+
+	firingID := fmt.Sprintf("<%s@logalert>", msg.AlertID)
+
+	var messageID string
+
+	switch {
+	case msg.Resolved:
+		messageID = fmt.Sprintf("<%s.resolved@logalert>", msg.AlertID)
+	case msg.Repeat > 0:
+		messageID = fmt.Sprintf("<%s.%d@logalert>", msg.AlertID, msg.Repeat)
+	default:
+		return firingID, []string{"Message-ID: " + firingID}
+	}
+
+	if ref := msg.Refs[sn.name]; ref != "" {
+		firingID = ref
+	}
+
+	return messageID, []string{"In-Reply-To: " + firingID, "References: " + firingID, "Message-ID: " + messageID}
 }
 
 func (sn *SmtpNotifier) From() string {
@@ -119,15 +168,28 @@ func (sn *SmtpNotifier) Type() string {
 	return NotifierTypeMail
 }
 
-func (sn *SmtpNotifier) FormatText(text string) string {
-	return text
+// Render builds the message, the text values are escaped for html messages
+func (sn *SmtpNotifier) Render(msg *Message) error {
+	if sn.html {
+		return msg.Render(sn.name, sn.templates, escapeHTML)
+	}
+	return msg.Render(sn.name, sn.templates, nil)
 }
 
 func (sn *SmtpNotifier) Close() error {
 	return sn.client.Close()
 }
 
-func newSmtpMessage(from, to, subject, body string) []byte {
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", from, to, subject, body)
-	return []byte(msg)
+// newSmtpMessage builds the message, the headers are "Name: value" lines
+func newSmtpMessage(from, to, subject, body string, headers ...string) []byte {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n", from, to, subject)
+	for _, header := range headers {
+		msg += header + "\r\n"
+	}
+	return []byte(msg + "\r\n" + body + "\r\n")
+}
+
+// escapeHTML escapes the text keeping its line breaks
+func escapeHTML(text string) string {
+	return strings.Replace(html.EscapeString(text), "\n", "<br>\n", -1)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"reflect"
 	"testing"
 )
 
@@ -26,8 +27,49 @@ func TestSmtp(t *testing.T) {
 		Text: "Logalert SMTP notifier test message",
 	}
 
-	err = smtpNotifier.Send(context.Background(), msg)
+	_, err = smtpNotifier.Send(context.Background(), msg)
 	if err != nil {
 		t.Error(err)
 	}
 }
+
+func TestSmtpAlertHeaders(t *testing.T) {
+	sn := &SmtpNotifier{name: "mail"}
+	refs := map[string]string{"mail": "<a1@logalert>"}
+
+	tests := []struct {
+		name      string
+		msg       Message
+		messageID string
+		headers   []string
+	}{
+		{"1. Not alert", Message{}, "", nil},
+		{
+			"2. Firing",
+			Message{AlertID: "a1"},
+			"<a1@logalert>",
+			[]string{"Message-ID: <a1@logalert>"},
+		},
+		{
+			"3. Repeated",
+			Message{AlertID: "a1", Repeat: 2, Refs: refs},
+			"<a1.2@logalert>",
+			[]string{"In-Reply-To: <a1@logalert>", "References: <a1@logalert>", "Message-ID: <a1.2@logalert>"},
+		},
+		{
+			"4. Resolved",
+			Message{AlertID: "a1", Resolved: true, Refs: refs},
+			"<a1.resolved@logalert>",
+			[]string{"In-Reply-To: <a1@logalert>", "References: <a1@logalert>", "Message-ID: <a1.resolved@logalert>"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messageID, headers := sn.alertHeaders(test.msg)
+			if messageID != test.messageID || !reflect.DeepEqual(headers, test.headers) {
+				t.Errorf("expected %s %q, got %s %q", test.messageID, test.headers, messageID, headers)
+			}
+		})
+	}
+}
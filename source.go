@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+const SourceTypeFile = "file"
+
+// Source is a log input processed by the app until the context is cancelled
+type Source interface {
+	watch(ctx context.Context, wg *sync.WaitGroup)
+}
+
+func NewSource(cfg FileConfig, filters []*Filter) (Source, error) {
+	var (
+		source Source
+		err    error
+	)
+
+	switch cfg.Type {
+	case "", SourceTypeFile:
+		if isGlobPattern(cfg.Path) {
+			source, err = NewDiscoverer(cfg, filters)
+		} else {
+			source, err = NewWatcher(cfg, filters)
+		}
+	case SourceTypeJournald:
+		source, err = NewJournald(cfg, filters)
+	case SourceTypeSyslog:
+		source, err = NewSyslog(cfg, filters)
+	case SourceTypeExec:
+		source, err = NewExec(cfg, filters)
+	case SourceTypeDocker:
+		source, err = NewDockerDiscoverer(cfg, filters)
+	case SourceTypeKubernetes:
+		source, err = NewKubernetesDiscoverer(cfg, filters)
+	default:
+		return nil, fmt.Errorf("Source type '%s' is unsupported", cfg.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// maxQueueRecords limits the records queued while the messages are not sent,
+// e.g. the notifier is down
+const maxQueueRecords = 100000
+
+// recordQueue collects records received by the streaming log sources between checks.
+// The oldest records over the limit are dropped
+type recordQueue struct {
+	sync.Mutex
+	name    string
+	records []Record
+	dropped int
+}
+
+func (q *recordQueue) push(records ...Record) {
+	q.Lock()
+	q.records = append(q.records, records...)
+	q.drop()
+	q.Unlock()
+}
+
+// pop returns the queued records and logs the number of the dropped ones
+func (q *recordQueue) pop() []Record {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.dropped > 0 {
+		log.Printf("[WARN] %d records are dropped, the queue is full: %s", q.dropped, q.name)
+		q.dropped = 0
+	}
+
+	records := q.records
+	q.records = nil
+
+	return records
+}
+
+// requeue returns not processed records to the queue head
+func (q *recordQueue) requeue(records []Record) {
+	q.Lock()
+	q.records = append(records, q.records...)
+	q.drop()
+	q.Unlock()
+}
+
+func (q *recordQueue) drop() {
+	if over := len(q.records) - maxQueueRecords; over > 0 {
+		q.records = q.records[over:]
+		q.dropped += over
+	}
+}
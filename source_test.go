@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRecordQueueLimit(t *testing.T) {
+	q := recordQueue{name: "test"}
+
+	for i := 0; i < maxQueueRecords; i++ {
+		q.push(Record{Text: "new"})
+	}
+
+	// the requeued records are older than the queued ones
+	q.requeue([]Record{{Text: "old 1"}, {Text: "old 2"}})
+
+	if q.dropped != 2 || len(q.records) != maxQueueRecords || q.records[0].Text != "new" {
+		t.Fatalf("expected the oldest records dropped, got %d dropped, first %+v", q.dropped, q.records[0])
+	}
+
+	q.push(Record{Text: "last"})
+
+	records := q.pop()
+	if len(records) != maxQueueRecords || records[len(records)-1].Text != "last" || q.dropped != 0 {
+		t.Errorf("unexpected records: %d, last %+v", len(records), records[len(records)-1])
+	}
+}
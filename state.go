@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// stateFilePath returns path of the state file for the log source key (e.g. the log file path)
+func stateFilePath(key string) (string, error) {
+	var statePath string
+
+	switch runtime.GOOS {
+	case "linux":
+		statePath = "/var/lib/logalert"
+	case "darwin":
+		statePath = "/usr/local/var/lib/logalert"
+	default:
+		return "", fmt.Errorf("%s OS is not supported", runtime.GOOS)
+	}
+
+	_, err := os.Stat(statePath)
+	if err != nil {
+		return "", err
+	}
+
+	keyHash := md5.Sum([]byte(key))
+
+	return fmt.Sprintf("%s/%x", statePath, keyHash), nil
+}
+
+// readState loads the state from the file, missing file is not an error
+func readState(path string, state interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("ReadFile error: %v", err)
+	}
+
+	err = json.Unmarshal(b, state)
+	if err != nil {
+		return fmt.Errorf("state unmarshal error: %v", err)
+	}
+
+	return nil
+}
+
+func writeState(path string, state interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(file, string(b))
+
+	return err
+}
@@ -2,8 +2,31 @@
 
 package main
 
+import (
+	"os"
+	"syscall"
+)
+
 type State struct {
-	Pos int64
-	Dev uint64
-	Ino uint64
+	Pos             int64
+	Dev             uint64
+	Ino             uint64
+	Fingerprint     string
+	FingerprintSize int64
+	Cursor          string
+}
+
+func newState(fileInfo os.FileInfo, pos int64) State {
+	sys := fileInfo.Sys().(*syscall.Stat_t)
+
+	return State{
+		Pos: pos,
+		Dev: sys.Dev,
+		Ino: sys.Ino,
+	}
+}
+
+func (s State) sameFile(fileInfo os.FileInfo) bool {
+	sys, ok := fileInfo.Sys().(*syscall.Stat_t)
+	return ok && s.Dev == sys.Dev && s.Ino == sys.Ino
 }
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SourceTypeSyslog = "syslog"
+
+// syslogMaxFrameSize limits the size of the octet-counted TCP frame
+const syslogMaxFrameSize = 1024 * 1024
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+type SyslogConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+// Syslog receives syslog messages from the network or unix socket
+type Syslog struct {
+	name          string
+	network       string
+	address       string
+	checkInterval time.Duration
+	processor     *Processor
+	queue         recordQueue
+}
+
+func NewSyslog(cfg FileConfig, filters []*Filter) (*Syslog, error) {
+	listenURL, err := url.Parse(cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("syslog source %s listen address error: %v", cfg.Name, err)
+	}
+
+	s := &Syslog{
+		name:          cfg.Name,
+		network:       listenURL.Scheme,
+		checkInterval: time.Second * time.Duration(cfg.IntervalSec),
+		queue:         recordQueue{name: "syslog receiver " + cfg.Name},
+	}
+
+	switch s.network {
+	case "udp", "tcp":
+		s.address = listenURL.Host
+	case "unix", "unixgram":
+		s.address = listenURL.Path
+	default:
+		return nil, fmt.Errorf("syslog source %s network '%s' is unsupported", cfg.Name, s.network)
+	}
+
+	s.processor, err = NewProcessor(cfg, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Syslog) watch(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	log.Printf("[INFO] starting syslog receiver %s on %s://%s", s.name, s.network, s.address)
+
+	if err := s.listen(ctx); err != nil {
+		log.Fatalf("[ERROR] syslog listen error: %v receiver: %s", err, s.name)
+	}
+
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.check(ctx)
+		}
+	}
+}
+
+func (s *Syslog) check(ctx context.Context) {
+	records := s.queue.pop()
+
+	messages := s.processor.processRecords(records)
+
+	if err := s.processor.sendMessages(ctx, messages); err != nil {
+		log.Printf("[ERROR] syslog receiver %s: %v", s.name, err)
+
+		// the records are processed again on the next check
+		s.queue.requeue(records)
+	}
+}
+
+func (s *Syslog) listen(ctx context.Context) error {
+	if s.network == "unix" || s.network == "unixgram" {
+		// remove the socket file left after the previous run, the other files are kept
+		if fInfo, err := os.Lstat(s.address); err == nil && fInfo.Mode()&os.ModeSocket != 0 {
+			os.Remove(s.address)
+		}
+	}
+
+	if s.network == "udp" || s.network == "unixgram" {
+		conn, err := net.ListenPacket(s.network, s.address)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+
+		go s.readPackets(conn)
+
+		return nil
+	}
+
+	listener, err := net.Listen(s.network, s.address)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	go s.accept(ctx, listener)
+
+	return nil
+}
+
+// readPackets receives one syslog message per datagram
+func (s *Syslog) readPackets(conn net.PacketConn) {
+	buf := make([]byte, 65536)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		record := parseSyslog(strings.TrimRight(string(buf[:n]), "\r\n\x00"))
+		record.Time = time.Now()
+
+		s.queue.push(record)
+	}
+}
+
+func (s *Syslog) accept(ctx context.Context, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[ERROR] syslog accept error: %v receiver: %s", err, s.name)
+			}
+			return
+		}
+
+		go s.readStream(ctx, conn)
+	}
+}
+
+// readStream receives octet-counted or newline delimited syslog messages
+func (s *Syslog) readStream(ctx context.Context, conn net.Conn) {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		frame, err := readSyslogFrame(reader)
+		if frame != "" {
+			record := parseSyslog(frame)
+			record.Time = time.Now()
+
+			s.queue.push(record)
+		}
+
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				log.Printf("[ERROR] syslog read error: %v receiver: %s", err, s.name)
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame reads the message with the octet counting (RFC 6587 3.4.1)
+// or the non-transparent framing (RFC 6587 3.4.2)
+func readSyslogFrame(reader *bufio.Reader) (string, error) {
+	b, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if b[0] < '1' || b[0] > '9' {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	lenStr, err := reader.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+
+	frameLen, err := strconv.Atoi(strings.TrimSuffix(lenStr, " "))
+	if err != nil || frameLen > syslogMaxFrameSize {
+		return "", fmt.Errorf("incorrect frame length '%s'", strings.TrimSuffix(lenStr, " "))
+	}
+
+	frame := make([]byte, frameLen)
+
+	if _, err = io.ReadFull(reader, frame); err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(frame), "\r\n"), nil
+}
+
+// parseSyslog parses RFC 5424 and RFC 3164 messages.
+// The message text is returned as the record text and the header as the record fields:
+// facility, severity, timestamp, hostname, appname, procid, msgid
+func parseSyslog(frame string) Record {
+	record := Record{Text: frame}
+
+	if !strings.HasPrefix(frame, "<") {
+		return record
+	}
+
+	end := strings.IndexByte(frame, '>')
+	if end < 2 || end > 4 {
+		return record
+	}
+
+	pri, err := strconv.Atoi(frame[1:end])
+	if err != nil || pri < 0 || pri/8 >= len(syslogFacilities) {
+		return record
+	}
+
+	record.Fields = map[string]string{
+		"facility": syslogFacilities[pri/8],
+		"severity": syslogSeverities[pri%8],
+	}
+
+	rest := frame[end+1:]
+
+	if strings.HasPrefix(rest, "1 ") {
+		record.Text = parseRFC5424(rest[2:], record.Fields)
+	} else {
+		record.Text = parseRFC3164(rest, record.Fields)
+	}
+
+	return record
+}
+
+// parseRFC5424 parses the message after the version:
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseRFC5424(rest string, fields map[string]string) string {
+	for _, name := range []string{"timestamp", "hostname", "appname", "procid", "msgid"} {
+		var value string
+		value, rest, _ = strings.Cut(rest, " ")
+		if value != "-" {
+			fields[name] = value
+		}
+	}
+
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		// structured data elements: [id param="value"]..., "]" may be escaped in values
+		var (
+			escaped bool
+			inside  bool
+			sdEnd   = len(rest)
+		)
+
+	loop:
+		for i := 0; i < len(rest); i++ {
+			switch c := rest[i]; {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '[':
+				inside = true
+			case c == ']':
+				inside = false
+			case c == ' ' && !inside:
+				sdEnd = i
+				break loop
+			}
+		}
+
+		fields["structured_data"] = rest[:sdEnd]
+		rest = rest[sdEnd:]
+	}
+
+	rest = strings.TrimPrefix(rest, " ")
+
+	return strings.TrimPrefix(rest, "\ufeff")
+}
+
+// parseRFC3164 parses the message after the priority:
+// TIMESTAMP [HOSTNAME] TAG[PID]: MSG
+func parseRFC3164(rest string, fields map[string]string) string {
+	const stampLen = len(time.Stamp)
+
+	hasTimestamp := false
+
+	if len(rest) > stampLen {
+		if _, err := time.Parse(time.Stamp, rest[:stampLen]); err == nil {
+			fields["timestamp"] = rest[:stampLen]
+			rest = strings.TrimPrefix(rest[stampLen:], " ")
+			hasTimestamp = true
+		}
+	}
+
+	// hostname is optional, it follows the timestamp and is followed by the tag,
+	// so the first word of the message without header is not taken as hostname
+	if hasTimestamp {
+		token, afterToken, found := strings.Cut(rest, " ")
+		nextToken, _, _ := strings.Cut(afterToken, " ")
+
+		if found && !isSyslogTag(token) && isSyslogTag(nextToken) {
+			fields["hostname"] = token
+			rest = afterToken
+		}
+	}
+
+	tagEnd := strings.IndexAny(rest, ":[ ")
+	if tagEnd <= 0 || tagEnd > 48 || rest[tagEnd] == ' ' {
+		return rest
+	}
+
+	fields["appname"] = rest[:tagEnd]
+	rest = rest[tagEnd:]
+
+	if strings.HasPrefix(rest, "[") {
+		if pidEnd := strings.IndexByte(rest, ']'); pidEnd != -1 {
+			fields["procid"] = rest[1:pidEnd]
+			rest = rest[pidEnd+1:]
+		}
+	}
+
+	rest = strings.TrimPrefix(rest, ":")
+
+	return strings.TrimPrefix(rest, " ")
+}
+
+// isSyslogTag reports whether the RFC 3164 token is the tag,
+// the tag ends with ':' or contains pid in brackets
+func isSyslogTag(token string) bool {
+	return strings.HasSuffix(token, ":") || strings.Contains(token, "[")
+}
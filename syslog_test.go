@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSyslog(t *testing.T) {
+	tests := []struct {
+		name     string
+		frame    string
+		expected Record
+	}{
+		{
+			"1. RFC 3164",
+			"<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8",
+			Record{
+				Text: "'su root' failed for lonvick on /dev/pts/8",
+				Fields: map[string]string{
+					"facility":  "auth",
+					"severity":  "crit",
+					"timestamp": "Oct 11 22:14:15",
+					"hostname":  "mymachine",
+					"appname":   "su",
+				},
+			},
+		},
+		{
+			"2. RFC 3164 with pid and without hostname",
+			"<30>Oct  1 02:03:04 sshd[1234]: Accepted publickey for root",
+			Record{
+				Text: "Accepted publickey for root",
+				Fields: map[string]string{
+					"facility":  "daemon",
+					"severity":  "info",
+					"timestamp": "Oct  1 02:03:04",
+					"appname":   "sshd",
+					"procid":    "1234",
+				},
+			},
+		},
+		{
+			"3. RFC 5424",
+			"<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 " +
+				`[exampleSDID@32473 iut="3" eventSource="Application\]"] ` + "\ufeffAn application event",
+			Record{
+				Text: "An application event",
+				Fields: map[string]string{
+					"facility":        "local4",
+					"severity":        "notice",
+					"timestamp":       "2003-10-11T22:14:15.003Z",
+					"hostname":        "mymachine.example.com",
+					"appname":         "evntslog",
+					"msgid":           "ID47",
+					"structured_data": `[exampleSDID@32473 iut="3" eventSource="Application\]"]`,
+				},
+			},
+		},
+		{
+			"4. RFC 5424 without structured data",
+			"<11>1 - host app 42 - - ERROR disk is full",
+			Record{
+				Text: "ERROR disk is full",
+				Fields: map[string]string{
+					"facility": "user",
+					"severity": "err",
+					"hostname": "host",
+					"appname":  "app",
+					"procid":   "42",
+				},
+			},
+		},
+		{
+			"5. Without priority",
+			"plain message",
+			Record{Text: "plain message"},
+		},
+		{
+			"6. RFC 3164 without header",
+			"<13>ERROR disk full",
+			Record{
+				Text:   "ERROR disk full",
+				Fields: map[string]string{"facility": "user", "severity": "notice"},
+			},
+		},
+		{
+			"7. RFC 3164 without hostname and tag",
+			"<13>Oct 11 22:14:15 ERROR disk full",
+			Record{
+				Text: "ERROR disk full",
+				Fields: map[string]string{
+					"facility":  "user",
+					"severity":  "notice",
+					"timestamp": "Oct 11 22:14:15",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := parseSyslog(tt.frame)
+			if !reflect.DeepEqual(record, tt.expected) {
+				t.Errorf("Expected record %+v, received %+v", tt.expected, record)
+			}
+		})
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	stream := "15 <11>1 - - - - -" + "<11>newline framed\n" + "11 <11>1 - a b\n" + "<11>last without newline"
+	expected := []string{"<11>1 - - - - -", "<11>newline framed", "<11>1 - a b", "<11>last without newline"}
+
+	reader := bufio.NewReader(strings.NewReader(stream))
+
+	var frames []string
+
+	for {
+		frame, err := readSyslogFrame(reader)
+		if frame != "" {
+			frames = append(frames, frame)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if !reflect.DeepEqual(frames, expected) {
+		t.Errorf("Expected frames %q, received %q", expected, frames)
+	}
+}
+
+func TestSyslogListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "syslog.sock")
+
+	s, err := NewSyslog(FileConfig{Name: "unix_test", SyslogConfig: SyslogConfig{Listen: "unix://" + path}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the regular file isn't removed
+	createFileWithData(path, []byte("data\n"))
+
+	if err := s.listen(ctx); err == nil {
+		t.Fatal("expected listen error")
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected file kept, got %v", err)
+	}
+
+	// the socket file left after the previous run is removed
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	if err := s.listen(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
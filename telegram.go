@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/go-telegram/bot"
@@ -17,12 +18,18 @@ type TelegramConfig struct {
 }
 
 type TelegramNotifier struct {
-	name   string
-	bot    *bot.Bot
-	chatID int64
+	name      string
+	bot       *bot.Bot
+	chatID    int64
+	templates Templates
 }
 
 func NewTelegramNotifier(cfg NotificationConfig) (*TelegramNotifier, error) {
+	templates, err := NewTemplates(cfg.Name, cfg.TemplateConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := []bot.Option{
 		bot.WithCheckInitTimeout(time.Second * 10),
 	}
@@ -32,24 +39,32 @@ func NewTelegramNotifier(cfg NotificationConfig) (*TelegramNotifier, error) {
 		return nil, err
 	}
 
-	return &TelegramNotifier{cfg.Name, b, cfg.TelegramConfig.ChatID}, nil
+	return &TelegramNotifier{cfg.Name, b, cfg.TelegramConfig.ChatID, templates}, nil
 }
 
-func (tn *TelegramNotifier) Send(ctx context.Context, msg Message) error {
-	msg.BuildText()
-	msg.Text = tn.FormatText(msg.Text)
+func (tn *TelegramNotifier) Send(ctx context.Context, msg Message) (string, error) {
+	if err := tn.Render(&msg); err != nil {
+		return "", err
+	}
 
-	_, err := tn.bot.SendMessage(ctx, &bot.SendMessageParams{
+	params := &bot.SendMessageParams{
 		ChatID:    tn.chatID,
 		Text:      msg.Text,
 		ParseMode: models.ParseModeMarkdown,
-	})
+	}
+
+	// the repeated and resolved messages are the replies to the firing message of the alert
+	if (msg.Resolved || msg.Repeat > 0) && msg.Refs[tn.name] != "" {
+		params.ReplyToMessageID, _ = strconv.Atoi(msg.Refs[tn.name])
+		params.AllowSendingWithoutReply = true
+	}
 
+	sent, err := tn.bot.SendMessage(ctx, params)
 	if err != nil {
-		return fmt.Errorf("send error: %v", err)
+		return "", fmt.Errorf("send error: %v", err)
 	}
 
-	return nil
+	return strconv.Itoa(sent.ID), nil
 }
 
 func (tn TelegramNotifier) Name() string {
@@ -60,8 +75,20 @@ func (tn TelegramNotifier) Type() string {
 	return NotifierTypeTelegram
 }
 
-func (tn TelegramNotifier) FormatText(text string) string {
-	return bot.EscapeMarkdown(text)
+// Render builds the message, the text values are escaped for markdown.
+// The legacy template has no markup, its message is escaped entirely
+func (tn TelegramNotifier) Render(msg *Message) error {
+	if !msg.templates(tn.name, tn.templates).Text.legacy() {
+		return msg.Render(tn.name, tn.templates, bot.EscapeMarkdown)
+	}
+
+	if err := msg.Render(tn.name, tn.templates, nil); err != nil {
+		return err
+	}
+
+	msg.Text = bot.EscapeMarkdown(msg.Text)
+
+	return nil
 }
 
 func (tn *TelegramNotifier) Close() error {
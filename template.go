@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// legacyPlaceholderReg matches the legacy % placeholders, e.g. %filename, %{severity}
+var legacyPlaceholderReg = regexp.MustCompile(`%(?:hostname|filename|filepath|filtername|count|text|status|\{([^}]+)\})`)
+
+// MessageData is the data model of the message templates
+type MessageData struct {
+	Host      string
+	File      string
+	FilePath  string
+	Filter    string
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Fields    map[string]string
+	Lines     []string
+	// the lines before and after the first matched line
+	ContextBefore []string
+	ContextAfter  []string
+	Text          string
+	// the alert ID of the threshold and absence filters
+	AlertID string
+	// firing or resolved
+	Status string
+	// the alert condition is cleared, e.g. the absent records appeared
+	Resolved bool
+	// the number of the identical messages suppressed by the filter cooldown since the time
+	Suppressed      int
+	SuppressedSince time.Time
+}
+
+// escape returns a copy of the data with escaped string values
+func (d MessageData) escape(escape func(string) string) MessageData {
+	d.Host = escape(d.Host)
+	d.File = escape(d.File)
+	d.FilePath = escape(d.FilePath)
+	d.Filter = escape(d.Filter)
+	d.Text = escape(d.Text)
+
+	if d.Fields != nil {
+		fields := make(map[string]string, len(d.Fields))
+		for name, value := range d.Fields {
+			fields[name] = escape(value)
+		}
+		d.Fields = fields
+	}
+
+	d.Lines = escapeLines(d.Lines, escape)
+	d.ContextBefore = escapeLines(d.ContextBefore, escape)
+	d.ContextAfter = escapeLines(d.ContextAfter, escape)
+
+	return d
+}
+
+func escapeLines(lines []string, escape func(string) string) []string {
+	if lines == nil {
+		return nil
+	}
+
+	escaped := make([]string, len(lines))
+	for i, line := range lines {
+		escaped[i] = escape(line)
+	}
+
+	return escaped
+}
+
+// Templates are the message subject and text templates, nil template is not set
+type Templates struct {
+	Subject *MessageTemplate
+	Text    *MessageTemplate
+}
+
+// TemplateConfig is the message subject and text of a notifier
+type TemplateConfig struct {
+	Subject string `yaml:"subject"`
+	Message string `yaml:"message"`
+}
+
+func NewTemplates(name string, cfg TemplateConfig) (Templates, error) {
+	var (
+		t   Templates
+		err error
+	)
+
+	if cfg.Subject != "" {
+		if t.Subject, err = NewMessageTemplate(name, cfg.Subject); err != nil {
+			return t, fmt.Errorf("subject template error: %v", err)
+		}
+	}
+
+	if cfg.Message != "" {
+		if t.Text, err = NewMessageTemplate(name, cfg.Message); err != nil {
+			return t, fmt.Errorf("message template error: %v", err)
+		}
+	}
+
+	return t, nil
+}
+
+// merge returns the templates with the not set ones taken from the defaults
+func (t Templates) merge(defaults Templates) Templates {
+	if t.Subject == nil {
+		t.Subject = defaults.Subject
+	}
+	if t.Text == nil {
+		t.Text = defaults.Text
+	}
+	return t
+}
+
+// MessageTemplate renders the message text or subject.
+// Go text/template is used if the format contains "{{",
+// otherwise the legacy % placeholders are replaced
+type MessageTemplate struct {
+	format string
+	tmpl   *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"truncate": templateTruncate,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"json":     templateJSON,
+	"since":    templateSince,
+	"join":     templateJoin,
+}
+
+func NewMessageTemplate(name, format string) (*MessageTemplate, error) {
+	t := &MessageTemplate{format: format}
+
+	if !strings.Contains(format, "{{") {
+		return t, nil
+	}
+
+	var err error
+
+	t.tmpl, err = template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(format)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Render renders the template escaping the data values for the notifier format, e.g. HTML,
+// so the template can contain the markup of the notifier format
+func (t *MessageTemplate) Render(data MessageData, escape func(string) string) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+
+	if t.tmpl == nil {
+		// the resolved messages are marked if the legacy template has no status,
+		// in the escaped formats the text value is marked to keep the markup valid
+		mark := data.Resolved && !strings.Contains(t.format, "%status")
+		if mark && escape != nil {
+			data.Text = "[RESOLVED] " + data.Text
+		}
+
+		text := t.renderLegacy(data, escape)
+
+		if mark && escape == nil && text != "" {
+			text = "[RESOLVED] " + text
+		}
+
+		return text, nil
+	}
+
+	if escape == nil {
+		escape = func(s string) string { return s }
+	}
+
+	var buf bytes.Buffer
+
+	if err := t.tmpl.Execute(&buf, data.escape(escape)); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// legacy reports whether the template uses the legacy % placeholders
+func (t *MessageTemplate) legacy() bool {
+	return t != nil && t.tmpl == nil
+}
+
+// renderLegacy replaces the % placeholders in one pass, so the placeholders
+// in the substituted values (e.g. "%text" in the log line) are kept as is.
+// Missing fields are replaced with empty string. The substituted values are escaped
+// with the escape function if it's set
+func (t *MessageTemplate) renderLegacy(data MessageData, escape func(string) string) string {
+	return legacyPlaceholderReg.ReplaceAllStringFunc(t.format, func(placeholder string) string {
+		value := legacyValue(placeholder, data)
+		if escape != nil {
+			value = escape(value)
+		}
+		return value
+	})
+}
+
+// legacyValue returns the value of the % placeholder
+func legacyValue(placeholder string, data MessageData) string {
+	switch placeholder {
+	case "%hostname":
+		return data.Host
+	case "%filename":
+		return data.File
+	case "%filepath":
+		return data.FilePath
+	case "%filtername":
+		return data.Filter
+	case "%count":
+		return strconv.Itoa(data.Count)
+	case "%text":
+		return data.Text
+	case "%status":
+		return strings.ToUpper(data.Status)
+	}
+	return data.Fields[placeholder[2:len(placeholder)-1]]
+}
+
+// templateTruncate cuts the string to n runes adding "…", e.g. {{ .Text | truncate 200 }}
+func templateTruncate(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+func templateJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// templateSince returns the time passed since t rounded to seconds, e.g. {{ since .FirstSeen }}
+func templateSince(t time.Time) string {
+	return time.Since(t).Round(time.Second).String()
+}
+
+// templateJoin joins the lines, e.g. {{ .Lines | join "\n" }}
+func templateJoin(sep string, items []string) string {
+	return strings.Join(items, sep)
+}
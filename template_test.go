@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageTemplate(t *testing.T) {
+	data := MessageData{
+		Host:      "web1",
+		File:      "app",
+		FilePath:  "/var/log/app.log",
+		Filter:    "Error",
+		Count:     3,
+		FirstSeen: time.Now().Add(-90 * time.Second),
+		Fields:    map[string]string{"user.id": "42", "level": "error"},
+		Lines:     []string{"10:15:25 ERROR a", "10:15:26 ERROR a"},
+		Text:      "ERROR payment failed: %count %filename",
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{
+			"1. Legacy placeholders",
+			"%hostname: %filename %filepath [%filtername] (%count) %{user.id} %{missing}\n%text",
+			"web1: app /var/log/app.log [Error] (3) 42 \nERROR payment failed: %count %filename",
+		},
+		{
+			"2. Template fields",
+			`{{ .Host }} {{ .Filter | upper }} {{ index .Fields "user.id" }} {{ .Fields.level }}{{ .Fields.missing }}`,
+			"web1 ERROR 42 error",
+		},
+		{
+			"3. Conditionals",
+			`{{ if gt .Count 1 }}{{ .Count }} times: {{ end }}{{ .Text | truncate 13 }}`,
+			"3 times: ERROR payment…",
+		},
+		{
+			"4. Lines and json",
+			`{{ .Lines | join "; " }} {{ json .Fields }} {{ since .FirstSeen }}`,
+			`10:15:25 ERROR a; 10:15:26 ERROR a {"level":"error","user.id":"42"} 1m30s`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := NewMessageTemplate("test", tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := tmpl.Render(data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.expected {
+				t.Errorf("got %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMessageTemplateError(t *testing.T) {
+	if _, err := NewMessageTemplate("test", "{{ .Text | unknown }}"); err == nil {
+		t.Error("expected parse error")
+	}
+
+	tmpl, err := NewMessageTemplate("test", "{{ .Unknown }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tmpl.Render(MessageData{}, nil); err == nil {
+		t.Error("expected execute error")
+	}
+}
+
+func TestMessageRenderEscape(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		escape   func(string) string
+		expected string
+	}{
+		{
+			"1. Legacy template values are escaped",
+			"<b>%filename</b>\n%text",
+			escapeHTML,
+			"<b>app</b>\nERROR &lt;nil&gt;<br>\nat main.go",
+		},
+		{
+			"2. Template values are escaped",
+			"<b>{{ .File }}</b>\n<pre>{{ .Text }}</pre>",
+			escapeHTML,
+			"<b>app</b>\n<pre>ERROR &lt;nil&gt;<br>\nat main.go</pre>",
+		},
+		{
+			"3. Without escaping",
+			"<b>{{ .File }}</b> {{ .Text }}",
+			nil,
+			"<b>app</b> ERROR <nil>\nat main.go",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewFilter(FilterConfig{Name: "Error", Message: tt.format}, "web1", nil, &Grok{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := Message{FileName: "app", Text: "ERROR <nil>\nat main.go", Filter: filter}
+
+			if err := msg.Render("mail", Templates{}, tt.escape); err != nil {
+				t.Fatal(err)
+			}
+
+			if msg.Text != tt.expected {
+				t.Errorf("got %q, expected %q", msg.Text, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMessageTemplateStatus(t *testing.T) {
+	data := MessageData{File: "app", Text: "backup completed", Status: AlertStatusResolved, Resolved: true}
+
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{"1. Legacy resolved mark", "%filename: %text", "[RESOLVED] app: backup completed"},
+		{"2. Legacy status", "%status %filename", "RESOLVED app"},
+		{"3. Template status", "{{ .Status }} {{ .File }}", "resolved app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := NewMessageTemplate("test", tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := tmpl.Render(data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.expected {
+				t.Errorf("got %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLegacyTemplateEscape(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{Name: "Error", Message: `{"text": "%text"}`}, "web1", nil, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the resolved mark and the suppressed count are the part of the escaped text value
+	msg := Message{Text: `backup "daily"`, Resolved: true, Suppressed: 2, Filter: filter}
+
+	if err := msg.Render("hook", Templates{}, escapeJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal([]byte(msg.Text), &body); err != nil {
+		t.Fatalf("body %s decode error: %v", msg.Text, err)
+	}
+
+	if !strings.HasPrefix(body["text"], `[RESOLVED] backup "daily"`) || !strings.Contains(body["text"], "… and 2 more since") {
+		t.Errorf("unexpected text: %q", body["text"])
+	}
+
+	// the legacy telegram message has no markup, it's escaped entirely
+	filter, err = NewFilter(FilterConfig{Name: "Error", Message: "%filename (%count)"}, "web1", nil, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg = Message{FileName: "app_1", Count: 2, Filter: filter}
+
+	if err := (TelegramNotifier{name: "tg"}).Render(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Text != `app\_1 \(2\)` {
+		t.Errorf("unexpected telegram text: %q", msg.Text)
+	}
+}
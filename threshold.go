@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	ThresholdSliding  = "sliding"
+	ThresholdTumbling = "tumbling"
+)
+
+// ThresholdConfig makes the filter alert only if at least count records
+// are matched within the window, independent of the check interval
+type ThresholdConfig struct {
+	Count     uint   `yaml:"count"`
+	WindowSec uint   `yaml:"window"`
+	Type      string `yaml:"type"`
+}
+
+type Threshold struct {
+	count    int
+	window   time.Duration
+	tumbling bool
+}
+
+// thresholdState is the matches count of the filter, persisted by the processor
+type thresholdState struct {
+	// sliding window matches counts per second
+	Buckets []thresholdBucket `json:"buckets,omitempty"`
+	// tumbling window
+	WindowStart int64 `json:"windowStart,omitempty"`
+	Count       int   `json:"count,omitempty"`
+	Fired       bool  `json:"fired,omitempty"`
+	// the last time the threshold was reached, the alert is resolved a window later
+	LastReached time.Time `json:"lastReached,omitempty"`
+}
+
+type thresholdBucket struct {
+	Time  int64 `json:"time"`
+	Count int   `json:"count"`
+}
+
+// NewThreshold returns nil if the threshold is not configured
+func NewThreshold(cfg ThresholdConfig) (*Threshold, error) {
+	if cfg.Count == 0 {
+		return nil, nil
+	}
+
+	if cfg.WindowSec == 0 {
+		return nil, fmt.Errorf("threshold window is not set")
+	}
+
+	t := &Threshold{
+		count:  int(cfg.Count),
+		window: time.Second * time.Duration(cfg.WindowSec),
+	}
+
+	switch cfg.Type {
+	case "", ThresholdSliding:
+	case ThresholdTumbling:
+		t.tumbling = true
+	default:
+		return nil, fmt.Errorf("threshold type '%s' is unsupported", cfg.Type)
+	}
+
+	return t, nil
+}
+
+// add counts the matches and reports whether the threshold is reached.
+// Returns the number of matches within the window and the window start.
+// The sliding window is cleared when the threshold is reached,
+// the tumbling window is reached once
+func (t *Threshold) add(state *thresholdState, count int, now time.Time) (int, time.Time, bool) {
+	if t.tumbling {
+		return t.addTumbling(state, count, now)
+	}
+
+	windowStart := now.Add(-t.window).Unix()
+
+	buckets := state.Buckets[:0]
+	for _, bucket := range state.Buckets {
+		if bucket.Time > windowStart {
+			buckets = append(buckets, bucket)
+		}
+	}
+
+	if count > 0 {
+		if len(buckets) > 0 && buckets[len(buckets)-1].Time == now.Unix() {
+			buckets[len(buckets)-1].Count += count
+		} else {
+			buckets = append(buckets, thresholdBucket{now.Unix(), count})
+		}
+	}
+
+	state.Buckets = buckets
+
+	total := 0
+	for _, bucket := range buckets {
+		total += bucket.Count
+	}
+
+	if total < t.count {
+		return total, time.Time{}, false
+	}
+
+	first := time.Unix(buckets[0].Time, 0)
+	state.Buckets = nil
+
+	return total, first, true
+}
+
+func (t *Threshold) addTumbling(state *thresholdState, count int, now time.Time) (int, time.Time, bool) {
+	windowLen := int64(t.window / time.Second)
+
+	// the windows are aligned to the epoch, e.g. 5 minutes windows start at 10:00, 10:05 ...
+	windowStart := now.Unix() - now.Unix()%windowLen
+
+	if state.WindowStart != windowStart {
+		*state = thresholdState{WindowStart: windowStart, LastReached: state.LastReached}
+	}
+
+	state.Count += count
+
+	if state.Fired || state.Count < t.count {
+		return state.Count, time.Time{}, false
+	}
+
+	state.Fired = true
+
+	return state.Count, time.Unix(windowStart, 0), true
+}
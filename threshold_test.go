@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThreshold(t *testing.T) {
+	start := time.Date(2023, 10, 12, 10, 0, 0, 0, time.UTC)
+
+	type add struct {
+		afterSec int
+		count    int
+		total    int
+		reached  bool
+	}
+
+	tests := []struct {
+		name string
+		cfg  ThresholdConfig
+		adds []add
+	}{
+		{
+			"1. Sliding window",
+			ThresholdConfig{Count: 5, WindowSec: 60},
+			[]add{
+				{0, 2, 2, false},
+				{30, 2, 4, false},
+				// the first matches are out of the window
+				{61, 2, 4, false},
+				{70, 1, 5, true},
+				// the window is cleared
+				{71, 1, 1, false},
+			},
+		},
+		{
+			"2. Tumbling window",
+			ThresholdConfig{Count: 3, WindowSec: 60, Type: ThresholdTumbling},
+			[]add{
+				{0, 2, 2, false},
+				{30, 1, 3, true},
+				// reached once per window
+				{40, 5, 8, false},
+				{60, 2, 2, false},
+				{119, 1, 3, true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			threshold, err := NewThreshold(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			state := &thresholdState{}
+
+			for i, a := range tt.adds {
+				total, _, reached := threshold.add(state, a.count, start.Add(time.Duration(a.afterSec)*time.Second))
+				if total != a.total || reached != a.reached {
+					t.Errorf("add %d: got %d %v, expected %d %v", i+1, total, reached, a.total, a.reached)
+				}
+			}
+		})
+	}
+}
+
+func TestThresholdConfigError(t *testing.T) {
+	for _, cfg := range []ThresholdConfig{{Count: 1}, {Count: 1, WindowSec: 60, Type: "fixed"}} {
+		if _, err := NewThreshold(cfg); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
@@ -2,78 +2,68 @@ package main
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"regexp"
-	"runtime"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 )
 
-const rotationDepth = 3
-
 type Watcher struct {
 	buf           []byte
-	dateReg       *regexp.Regexp
 	state         State
 	stateFilePath string
-	fileName      string
 	filePath      string
-	fileInfoPrev  os.FileInfo
-	fileInfoCurr  os.FileInfo
-	posCurr       int64
+	stateCurr     State
+	rotation      *Rotation
 	checkInterval time.Duration
-	filters       []*Filter
+	lastCheck     time.Time
+	inotify       bool
+	processor     *Processor
+	decoder       lineDecoder
+	fields        map[string]string
 	needToSave    bool
+	// the incomplete lines of the decoder by stream, saved with the position,
+	// so they are not joined twice when the lines are read again after the sending failure
+	partial     map[string]string
+	partialCurr map[string]string
 }
 
-func NewWatcher(cfg FileConfig, filters []*Filter) (*Watcher, error) {
-	var statePath string
+// watcherState is the persisted watcher state
+type watcherState struct {
+	State
+	Partial map[string]string `json:",omitempty"`
+}
+
+// lineDecoder converts raw log lines to records, e.g. unwraps container runtime log formats.
+// The second value is false if the line is incomplete and buffered in the partial lines by stream
+type lineDecoder interface {
+	decode(line string, partial map[string]string) (Record, bool)
+}
 
-	switch runtime.GOOS {
-	case "linux":
-		statePath = "/var/lib/logalert"
-	case "darwin":
-		statePath = "/usr/local/var/lib/logalert"
-	default:
-		return nil, fmt.Errorf("%s OS is not supported", runtime.GOOS)
+func NewWatcher(cfg FileConfig, filters []*Filter) (*Watcher, error) {
+	stateFilePath, err := stateFilePath(cfg.Path)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err := os.Stat(statePath)
+	processor, err := NewProcessor(cfg, filters)
 	if err != nil {
 		return nil, err
 	}
 
 	w := Watcher{
 		buf:           newBuffer(cfg.ReadBufferSize),
-		fileName:      cfg.Name,
+		stateFilePath: stateFilePath,
 		filePath:      cfg.Path,
 		checkInterval: time.Second * time.Duration(cfg.IntervalSec),
-		filters:       make([]*Filter, 0, len(cfg.Filters)),
+		inotify:       cfg.Inotify,
+		processor:     processor,
 	}
 
-	for _, filterName := range cfg.Filters {
-		found := false
-		for _, filter := range filters {
-			if filter.Name == filterName {
-				w.filters = append(w.filters, filter)
-				found = true
-			}
-		}
-		if !found {
-			return nil, fmt.Errorf("Unknown filter: %s", filterName)
-		}
-	}
-
-	filePathHash := md5.Sum([]byte(cfg.Path))
-	w.stateFilePath = fmt.Sprintf("%s/%x", statePath, filePathHash)
-
 	if len(w.buf) == 0 {
 		log.Fatalf("Can't create read buffer with size %s for logfile %s",
 			cfg.ReadBufferSize,
@@ -86,7 +76,7 @@ func NewWatcher(cfg FileConfig, filters []*Filter) (*Watcher, error) {
 		return nil, err
 	}
 
-	w.fileInfoCurr, err = file.Stat()
+	fileInfo, err := file.Stat()
 	if err != nil {
 		file.Close()
 		log.Fatal(err)
@@ -94,72 +84,61 @@ func NewWatcher(cfg FileConfig, filters []*Filter) (*Watcher, error) {
 
 	file.Close()
 
-	w.fileInfoPrev = w.fileInfoCurr
-
 	err = w.loadState()
 	if err != nil {
 		return nil, err
 	}
 
-	w.dateReg, err = regexp.Compile(cfg.DateFormat)
+	if (w.state == State{}) {
+		w.state = newState(fileInfo, 0)
+	}
+
+	w.stateCurr = w.state
+
+	w.rotation, err = NewRotation(cfg.Rotation, cfg.Path)
 	if err != nil {
-		return nil, fmt.Errorf("LogFile %s date pattern compile error: %v", cfg.Path, err)
+		return nil, err
 	}
 
 	return &w, nil
 }
 
-func (w *Watcher) saveState(fileInfo os.FileInfo, pos int64) error {
+func (w *Watcher) saveState() error {
 	if !w.needToSave {
 		return nil
 	}
 
-	file, err := os.Create(w.stateFilePath)
+	err := writeState(w.stateFilePath, watcherState{w.stateCurr, w.partialCurr})
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	sys := fileInfo.Sys().(*syscall.Stat_t)
+	w.state = w.stateCurr
+	w.partial = w.partialCurr
+	w.needToSave = false
 
-	state := State{
-		Pos: pos,
-		Dev: sys.Dev,
-		Ino: sys.Ino,
-	}
+	return nil
+}
 
-	b, err := json.Marshal(state)
-	if err != nil {
-		return err
-	}
+func (w *Watcher) loadState() error {
+	var state watcherState
 
-	_, err = fmt.Fprint(file, string(b))
-	if err != nil {
+	if err := readState(w.stateFilePath, &state); err != nil {
 		return err
 	}
 
-	w.state = state
-	w.needToSave = false
-	w.fileInfoPrev = fileInfo
+	w.state, w.partial = state.State, state.Partial
+	w.partialCurr = w.partial
 
 	return nil
 }
 
-func (w *Watcher) loadState() error {
-	b, err := os.ReadFile(w.stateFilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return fmt.Errorf("ReadFile error: %v", err)
-	}
-
-	err = json.Unmarshal(b, &w.state)
-	if err != nil {
-		return fmt.Errorf("state unmarshal error: %v", err)
+func (w *Watcher) removeState() error {
+	err := os.Remove(w.stateFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
-
-	return nil
+	return w.processor.removeState()
 }
 
 func (w *Watcher) watch(ctx context.Context, wg *sync.WaitGroup) {
@@ -167,195 +146,351 @@ func (w *Watcher) watch(ctx context.Context, wg *sync.WaitGroup) {
 
 	log.Printf("[INFO] starting monitoring log file: %s", w.filePath)
 
-	err := w.logParsingAndSendMessages(ctx)
-	if err != nil {
-		log.Fatal("[ERROR] logParsingAndSendNotifications: ", err)
-	}
+	// with inotify the file is checked as soon as it changes,
+	// but not more often than once per check interval
+	var events <-chan struct{}
 
-	err = w.saveState(w.fileInfoCurr, w.posCurr)
-	if err != nil {
-		log.Fatalf("[ERROR] state update error: %v log file: %s", err, w.filePath)
+	if w.inotify {
+		fileEvents, err := newFileEvents(w.filePath)
+		if err != nil {
+			log.Printf("[ERROR] %v, falling back to polling log file: %s", err, w.filePath)
+		} else {
+			defer fileEvents.Close()
+			events = fileEvents.C
+		}
 	}
 
+	w.check(ctx)
+
 	ticker := time.NewTicker(w.checkInterval)
+	defer ticker.Stop()
+
+	var delayed <-chan time.Time
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			err = w.logParsingAndSendMessages(ctx)
-			if err != nil {
-				log.Println("[ERROR] logParsingAndSendNotifications: ", err)
+			w.check(ctx)
+		case <-events:
+			if delayed != nil {
 				continue
 			}
 
-			err = w.saveState(w.fileInfoCurr, w.posCurr)
-			if err != nil {
-				log.Fatalf("[ERROR] state update error: %v log file: %s", err, w.filePath)
+			wait := w.checkInterval - time.Since(w.lastCheck)
+			if wait <= 0 {
+				w.check(ctx)
+				continue
 			}
+
+			delayed = time.After(wait)
+		case <-delayed:
+			delayed = nil
+			w.check(ctx)
 		}
 	}
 }
 
+func (w *Watcher) check(ctx context.Context) {
+	w.lastCheck = time.Now()
+
+	err := w.logParsingAndSendMessages(ctx)
+	if err != nil {
+		log.Println("[ERROR] logParsingAndSendNotifications: ", err)
+		return
+	}
+
+	err = w.saveState()
+	if err != nil {
+		log.Fatalf("[ERROR] state update error: %v log file: %s", err, w.filePath)
+	}
+}
+
 func (w *Watcher) logParsingAndSendMessages(ctx context.Context) error {
 	lines, err := w.getNewLines()
 	if err != nil {
-		return fmt.Errorf("getNewLines error: %v logFile: %s", err, w.filePath)
+		err = fmt.Errorf("getNewLines error: %v logFile: %s", err, w.filePath)
+
+		// the absence filters are checked without new lines, e.g. the log file is removed
+		if sendErr := w.processor.sendMessages(ctx, w.processor.processRecords(nil)); sendErr != nil {
+			return fmt.Errorf("%v, %v", err, sendErr)
+		}
+
+		return err
 	}
 
-	messages := w.processLines(lines)
+	messages := w.processor.processRecords(w.decodeLines(lines))
 
-	for _, msg := range messages {
-		for _, notifier := range msg.Filter.Notifiers {
-			if err := notifier.Send(ctx, msg); err != nil {
-				return fmt.Errorf("%s message send error: %v msg: %s", notifier.Type(), err, msg.Text)
-			}
-		}
+	if err := w.processor.sendMessages(ctx, messages); err != nil {
+		return err
 	}
 
-	if len(messages) > 0 {
+	if len(messages) > 0 || w.stateCurr != w.state || len(w.partialCurr) > 0 || len(w.partial) > 0 {
 		w.needToSave = true
 	}
 
 	return nil
 }
 
-func (w *Watcher) getNewLines() ([]string, error) {
-	fileIndex, fileInfo := searchFile(w.filePath, w.fileInfoPrev)
-	if fileIndex == -1 {
-		return nil, fmt.Errorf("Can't find log file '%s' state. The file was unexpectedly changed.", w.filePath)
+// decodeLines converts lines to records and adds the watcher fields to them.
+// The decoder continues the partial lines saved with the position
+func (w *Watcher) decodeLines(lines []string) []Record {
+	records := make([]Record, 0, len(lines))
+
+	var partial map[string]string
+	if w.decoder != nil {
+		partial = make(map[string]string, len(w.partial))
+		for stream, text := range w.partial {
+			partial[stream] = text
+		}
 	}
 
-	var (
-		pos         = w.state.Pos
-		linesResult []string
-	)
+	for _, line := range lines {
+		record := Record{Text: line}
 
-	for i := fileIndex; i >= 0; i-- {
-		filePath := w.filePath
-		if i > 0 {
-			filePath = fmt.Sprintf("%s.%d", w.filePath, i)
+		if w.decoder != nil {
+			var ok bool
+			if record, ok = w.decoder.decode(line, partial); !ok {
+				continue
+			}
 		}
 
-		file, err := os.Open(filePath)
+		if len(w.fields) > 0 {
+			fields := make(map[string]string, len(w.fields)+len(record.Fields))
+			for name, value := range w.fields {
+				fields[name] = value
+			}
+			for name, value := range record.Fields {
+				fields[name] = value
+			}
+			record.Fields = fields
+		}
+
+		records = append(records, record)
+	}
+
+	w.partialCurr = partial
+
+	return records
+}
+
+func (w *Watcher) getNewLines() ([]string, error) {
+	filePaths := w.rotation.files(w.filePath)
+
+	pos := w.state.Pos
+
+	// the lines before the lost position are not read again, the old records would be alerted twice.
+	// The lost state file is not checked for truncation, its fingerprint doesn't match the file
+	fileIndex := searchFile(filePaths, w.state)
+	if fileIndex == -1 {
+		fInfo, err := os.Stat(w.filePath)
 		if err != nil {
 			return nil, err
 		}
 
-		var (
-			readErr  error
-			partLine string
-			n        int
-		)
+		log.Printf("[WARN] Can't find log file '%s' state. The file was unexpectedly changed, reading it from the end", w.filePath)
+		fileIndex, pos = 0, fInfo.Size()
+	} else if fileIndex == 0 && isTruncated(w.filePath, w.state) {
+		log.Printf("[INFO] log file %s was truncated, reading it from the beginning", w.filePath)
+		fileIndex, pos = 0, 0
 
-		for readErr != io.EOF {
-			n, readErr = file.ReadAt(w.buf, pos)
-			if readErr != nil && readErr != io.EOF {
-				file.Close()
-				return nil, fmt.Errorf("file read error: %v file: %s", err, filePath)
+		// the unread tail is in the copy made before truncation
+		if w.rotation.copyTruncate {
+			if copyIndex := searchFingerprint(filePaths[1:], w.state); copyIndex != -1 {
+				fileIndex, pos = copyIndex+1, w.state.Pos
 			}
+		}
+	}
 
-			pos += int64(n)
-
-			lines := strings.Split(string(w.buf[:n]), "\n")
+	var (
+		fileInfo       os.FileInfo
+		fingerprint    string
+		fingerprintLen int64
+		linesResult    []string
+	)
 
-			if partLine != "" {
-				lines[0] = partLine + lines[0]
-				partLine = ""
-			}
+	for i := fileIndex; i >= 0; i-- {
+		filePath := filePaths[i]
 
-			if readErr != io.EOF && w.buf[len(w.buf)-1] != '\n' {
-				partLine = lines[len(lines)-1]
-				lines = lines[:len(lines)-1]
-			}
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
 
-			linesResult = append(linesResult, lines...)
+		lines, n, err := w.readLines(file, filePath, pos)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%v file: %s", err, filePath)
 		}
 
+		linesResult = append(linesResult, lines...)
+
 		fileInfo, err = file.Stat()
 		if err != nil {
+			file.Close()
 			return nil, err
 		}
 
-		file.Close()
+		pos += n
 
-		if i > 0 {
+		if i == 0 {
+			fingerprintLen = pos
+			if fingerprintLen > fingerprintSize {
+				fingerprintLen = fingerprintSize
+			}
+			fingerprint, _ = readFingerprint(io.NewSectionReader(file, 0, fingerprintLen), fingerprintLen)
+		} else {
 			pos = 0
 		}
+
+		file.Close()
 	}
 
-	w.fileInfoCurr = fileInfo
-	w.posCurr = pos
+	w.stateCurr = newState(fileInfo, pos)
+
+	w.processor.setModTime(fileInfo.ModTime())
+
+	if fingerprint != "" {
+		w.stateCurr.Fingerprint = fingerprint
+		w.stateCurr.FingerprintSize = fingerprintLen
+	}
 
 	return linesResult, nil
 }
 
-func (w *Watcher) processLines(lines []string) []Message {
-	matchMaps := make([]map[string]int, len(w.filters))
+// readLines reads lines of the (compressed) file starting from the position.
+// Returns lines and the number of read bytes
+func (w *Watcher) readLines(file *os.File, filePath string, pos int64) ([]string, int64, error) {
+	reader, err := decompress(file, filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decompress error: %v", err)
+	}
+	defer reader.Close()
 
-	for fIndex, filter := range w.filters {
-		matchMaps[fIndex] = make(map[string]int)
-		for _, line := range lines {
-			if filter.Match(line) {
-				line, _ = lineRemoveDate(line, w.dateReg)
+	if isCompressed(filePath) {
+		_, err = io.CopyN(io.Discard, reader, pos)
+	} else {
+		_, err = file.Seek(pos, io.SeekStart)
+	}
 
-				if _, ok := matchMaps[fIndex][line]; !ok {
-					matchMaps[fIndex][line] = 0
-				}
+	if err == io.EOF {
+		return nil, 0, nil
+	}
 
-				matchMaps[fIndex][line]++
-			}
-		}
+	if err != nil {
+		return nil, 0, fmt.Errorf("file seek error: %v", err)
 	}
 
-	var messages []Message
+	var (
+		readErr     error
+		partLine    string
+		n           int
+		read        int64
+		linesResult []string
+	)
+
+	for readErr != io.EOF {
+		n, readErr = io.ReadFull(reader, w.buf)
+		if readErr == io.ErrUnexpectedEOF {
+			readErr = io.EOF
+		}
 
-	for fIndex, filter := range w.filters {
-		for line, count := range matchMaps[fIndex] {
-			messages = append(messages, Message{
-				FileName: w.fileName,
-				Text:     line,
-				Count:    count,
-				Filter:   filter,
-			})
+		if readErr != nil && readErr != io.EOF {
+			return nil, 0, fmt.Errorf("file read error: %v", readErr)
 		}
+
+		read += int64(n)
+
+		lines := strings.Split(string(w.buf[:n]), "\n")
+
+		if partLine != "" {
+			lines[0] = partLine + lines[0]
+			partLine = ""
+		}
+
+		if readErr != io.EOF && w.buf[len(w.buf)-1] != '\n' {
+			partLine = lines[len(lines)-1]
+			lines = lines[:len(lines)-1]
+		}
+
+		linesResult = append(linesResult, lines...)
 	}
 
-	return messages
+	return linesResult, read, nil
 }
 
-// Returns file index and os.FileInfo
-// Example: filePath: /foo/bar/file
+// Returns index of the file described by the state.
+// The file is identified by device and inode together with the content fingerprint
+// (hash of the file head), so reused inodes are not confused with the tailed file,
+// and the moved, copied or compressed file is found by the content.
+// The index of the file with the same inode and changed content is returned
+// only for the current log file (index 0), that means it was truncated.
+// Example: filePaths: [/foo/bar/file, /foo/bar/file.1, /foo/bar/file.2.gz]
 // index = 0 on path /foo/bar/file founded
 // index = 1 on path /foo/bar/file.1 founded
+// index = 2 on path /foo/bar/file.2.gz founded
 // index = -1 if not founded
-func searchFile(filePath string, fileInfoPrev os.FileInfo) (int, os.FileInfo) {
-	for i := 0; i <= rotationDepth; i++ {
-		path := filePath
-		if i > 0 {
-			path = fmt.Sprintf("%s.%d", filePath, i)
-		}
+func searchFile(filePaths []string, state State) int {
+	contentIndex := -1
 
-		f, err := os.Open(path)
+	for i, path := range filePaths {
+		fInfo, err := os.Stat(path)
 		if err != nil {
-			log.Fatal(err)
+			continue
 		}
 
-		fInfo, err := f.Stat()
-		if err != nil {
-			f.Close()
-			log.Fatal(err)
+		sameInode := !isCompressed(path) && state.sameFile(fInfo)
+
+		// the state was saved without fingerprint, e.g. the file was empty
+		if state.Fingerprint == "" {
+			if sameInode {
+				return i
+			}
+			continue
 		}
 
-		f.Close()
+		// compressed file size can't be compared with the position
+		sameContent := matchFingerprint(path, state) && (isCompressed(path) || fInfo.Size() >= state.Pos)
 
-		if os.SameFile(fileInfoPrev, fInfo) {
-			return i, fInfo
+		switch {
+		case sameInode && sameContent:
+			return i
+		case sameInode && i == 0:
+			return i
+		case sameContent && contentIndex == -1:
+			contentIndex = i
 		}
 	}
 
-	return -1, fileInfoPrev
+	return contentIndex
+}
+
+// Returns index of the file with the content fingerprint of the state
+// or -1 if not founded
+func searchFingerprint(filePaths []string, state State) int {
+	for i, path := range filePaths {
+		if matchFingerprint(path, state) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isTruncated reports whether the file became shorter than the state position
+// or its head was overwritten
+func isTruncated(path string, state State) bool {
+	fInfo, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	if fInfo.Size() < state.Pos {
+		return true
+	}
+
+	return state.Fingerprint != "" && !matchFingerprint(path, state)
 }
 
 func lineRemoveDate(str string, reDate *regexp.Regexp) (string, bool) {
@@ -382,3 +517,12 @@ func removeDuplicates(strSlice []string) []string {
 	}
 	return dedup
 }
+
+func containsString(strSlice []string, str string) bool {
+	for _, s := range strSlice {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,18 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestBufferOverflow(t *testing.T) {
@@ -59,3 +67,434 @@ func createFileWithData(path string, data []byte) {
 		panic(err)
 	}
 }
+
+func TestCompressedRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+	}{
+		{"1. gzip", ".gz"},
+		{"2. zstd", ".zst"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logFilePath := filepath.Join(t.TempDir(), "test.log")
+			createFileWithData(logFilePath, []byte("first line\n"))
+
+			logCfgTest := FileConfig{
+				Path:           logFilePath,
+				ReadBufferSize: "1kb",
+			}
+
+			logWatcher, err := NewWatcher(logCfgTest, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer logWatcher.removeState()
+
+			if _, err = logWatcher.getNewLines(); err != nil {
+				t.Fatal(err)
+			}
+
+			logWatcher.needToSave = true
+			if err = logWatcher.saveState(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the tail is written and the file is rotated and compressed while logalert is down
+			appendFileData(t, logFilePath, []byte("unread line\n"))
+			if err = os.Rename(logFilePath, logFilePath+".1"); err != nil {
+				t.Fatal(err)
+			}
+			createFileWithData(logFilePath, []byte("new line\n"))
+			compressFile(t, logFilePath+".1", logFilePath+".1"+tt.ext)
+
+			logWatcher, err = NewWatcher(logCfgTest, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lines, err := logWatcher.getNewLines()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := []string{"unread line", "", "new line", ""}
+			if !reflect.DeepEqual(lines, expected) {
+				t.Errorf("Expected lines %q, received %q", expected, lines)
+			}
+		})
+	}
+}
+
+func TestCopyTruncate(t *testing.T) {
+	tests := []struct {
+		name         string
+		copyTruncate bool
+		expected     []string
+	}{
+		{"1. Without copy reading", false, []string{"new line", ""}},
+		{"2. With copy reading", true, []string{"unread line", "", "new line", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logFilePath := filepath.Join(t.TempDir(), "test.log")
+			createFileWithData(logFilePath, []byte("first line\n"))
+
+			logCfgTest := FileConfig{
+				Path:           logFilePath,
+				ReadBufferSize: "1kb",
+				Rotation:       RotationConfig{CopyTruncate: tt.copyTruncate},
+			}
+
+			logWatcher, err := NewWatcher(logCfgTest, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer logWatcher.removeState()
+
+			if _, err = logWatcher.getNewLines(); err != nil {
+				t.Fatal(err)
+			}
+
+			logWatcher.needToSave = true
+			if err = logWatcher.saveState(); err != nil {
+				t.Fatal(err)
+			}
+
+			appendFileData(t, logFilePath, []byte("unread line\n"))
+
+			data, err := os.ReadFile(logFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			createFileWithData(logFilePath+".1", data)
+
+			// truncated file keeps its inode
+			if err = os.Truncate(logFilePath, 0); err != nil {
+				t.Fatal(err)
+			}
+			appendFileData(t, logFilePath, []byte("new line\n"))
+
+			lines, err := logWatcher.getNewLines()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(lines, tt.expected) {
+				t.Errorf("Expected lines %q, received %q", tt.expected, lines)
+			}
+		})
+	}
+}
+
+func TestSearchFile(t *testing.T) {
+	dir := t.TempDir()
+
+	tailed := []byte("tailed file line\n")
+	other := []byte("other file line\n")
+
+	paths := []string{filepath.Join(dir, "test.log"), filepath.Join(dir, "test.log.1")}
+
+	stateOf := func(path string, data []byte) State {
+		fInfo, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state := newState(fInfo, int64(len(data)))
+		state.FingerprintSize = int64(len(data))
+		state.Fingerprint, _ = readFingerprint(bytes.NewReader(data), state.FingerprintSize)
+
+		return state
+	}
+
+	tests := []struct {
+		name     string
+		prepare  func() State
+		expected int
+	}{
+		{
+			"1. Rotated file",
+			func() State {
+				createFileWithData(paths[1], tailed)
+				createFileWithData(paths[0], other)
+				return stateOf(paths[1], tailed)
+			},
+			1,
+		},
+		{
+			"2. Inode of the rotated file is reused",
+			func() State {
+				createFileWithData(paths[1], other)
+				createFileWithData(paths[0], other)
+				return stateOf(paths[1], tailed)
+			},
+			-1,
+		},
+		{
+			"3. File was restored from backup",
+			func() State {
+				createFileWithData(paths[1], tailed)
+				createFileWithData(paths[0], other)
+				state := stateOf(paths[1], tailed)
+				state.Dev, state.Ino = 0, 0
+				return state
+			},
+			1,
+		},
+		{
+			"4. Current file was truncated",
+			func() State {
+				createFileWithData(paths[1], other)
+				createFileWithData(paths[0], other)
+				return stateOf(paths[0], tailed)
+			},
+			0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := tt.prepare()
+
+			if index := searchFile(paths, state); index != tt.expected {
+				t.Errorf("Expected file index %d, received %d", tt.expected, index)
+			}
+		})
+	}
+}
+
+func appendFileData(t *testing.T, path string, data []byte) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err = file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// compressFile compresses src to dst and removes src
+func compressFile(t *testing.T, src, dst string) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var w io.WriteCloser
+
+	switch filepath.Ext(dst) {
+	case ".gz":
+		w = gzip.NewWriter(file)
+	case ".zst":
+		w, err = zstd.NewWriter(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Remove(src); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherAbsenceMissingFile(t *testing.T) {
+	notifier := &testNotifier{}
+
+	filter, err := NewFilter(FilterConfig{
+		Name:           "heartbeat",
+		Type:           FilterTypeAbsence,
+		ExpectEverySec: 600,
+		ModTime:        true,
+		Notifications:  []string{"test"},
+	}, "host", []Notifier{notifier}, &Grok{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logFilePath := filepath.Join(t.TempDir(), "test.log")
+	createFileWithData(logFilePath, []byte("first line\n"))
+
+	logWatcher, err := NewWatcher(FileConfig{Path: logFilePath, ReadBufferSize: "1kb", Filters: []string{"heartbeat"}}, []*Filter{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logWatcher.removeState()
+
+	logWatcher.check(context.Background())
+
+	if err = os.Remove(logFilePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last modification of the removed file is before the expected period
+	logWatcher.processor.setModTime(time.Now().Add(-time.Hour))
+	logWatcher.processor.state.Absences["heartbeat"].LastSeen = time.Now().Add(-time.Hour)
+
+	// the absence message is sent again after the failed send
+	notifier.err = errors.New("connection refused")
+
+	for i := 0; i < 2; i++ {
+		if err = logWatcher.logParsingAndSendMessages(context.Background()); err == nil {
+			t.Fatal("expected missing file error")
+		}
+		notifier.err = nil
+	}
+
+	if len(notifier.sent) != 1 || notifier.sent[0].Resolved || notifier.sent[0].AlertID == "" {
+		t.Errorf("expected absence message, got %v", notifier.sent)
+	}
+}
+
+func TestWatcherLostState(t *testing.T) {
+	logFilePath := filepath.Join(t.TempDir(), "test.log")
+	createFileWithData(logFilePath, []byte("old line\n"))
+
+	logWatcher, err := NewWatcher(FileConfig{Path: logFilePath, ReadBufferSize: "1kb"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logWatcher.removeState()
+
+	if _, err := logWatcher.getNewLines(); err != nil {
+		t.Fatal(err)
+	}
+
+	logWatcher.needToSave = true
+	if err := logWatcher.saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	if logWatcher.state.Fingerprint == "" {
+		t.Fatal("expected the saved state with the fingerprint")
+	}
+
+	// the file is replaced, the saved state with the fingerprint is of another file
+	createFileWithData(logFilePath+".new", []byte("replaced line\n"))
+	if err := os.Rename(logFilePath+".new", logFilePath); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := logWatcher.getNewLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range lines {
+		if line != "" {
+			t.Fatalf("expected the file read from the end, received %q", lines)
+		}
+	}
+
+	logWatcher.state = logWatcher.stateCurr
+	appendFileData(t, logFilePath, []byte("new line\n"))
+
+	lines, err = logWatcher.getNewLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lines) == 0 || lines[0] != "new line" {
+		t.Errorf("expected new line, received %q", lines)
+	}
+}
+
+func TestWatcherPartialSendFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		decoder lineDecoder
+		lines   []string
+	}{
+		{
+			"1. Docker",
+			&dockerDecoder{},
+			[]string{
+				`{"log":"ERROR part 1, ","stream":"stdout","time":"2023-10-12T10:15:26.1Z"}`,
+				`{"log":"part 2\n","stream":"stdout","time":"2023-10-12T10:15:26.2Z"}`,
+			},
+		},
+		{
+			"2. CRI",
+			&criDecoder{},
+			[]string{
+				"2023-10-12T10:15:26.000000001Z stdout P ERROR part 1, ",
+				"2023-10-12T10:15:26.000000002Z stdout F part 2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.log")
+			createFileWithData(path, []byte(tt.lines[0]+"\n"))
+
+			notifier := &testNotifier{}
+
+			filter, err := NewFilter(FilterConfig{Name: "errors", Pattern: `ERROR`, Notifications: []string{"test"}}, "host", []Notifier{notifier}, &Grok{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := FileConfig{Name: "partial_test", Path: path, ReadBufferSize: "1kb", Filters: []string{"errors"}}
+
+			newWatcher := func() *Watcher {
+				watcher, err := NewWatcher(cfg, []*Filter{filter})
+				if err != nil {
+					t.Fatal(err)
+				}
+				watcher.decoder = tt.decoder
+				return watcher
+			}
+
+			watcher := newWatcher()
+			defer watcher.removeState()
+
+			ctx := context.Background()
+
+			if err := watcher.logParsingAndSendMessages(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := watcher.saveState(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the partial line is restored after restart
+			watcher = newWatcher()
+			appendFileData(t, path, []byte(tt.lines[1]+"\n"))
+
+			// the lines are read again after the sending failure, the partial line is joined once
+			notifier.err = errors.New("connection refused")
+			if err := watcher.logParsingAndSendMessages(ctx); err == nil {
+				t.Fatal("expected send error")
+			}
+
+			notifier.err = nil
+			if err := watcher.logParsingAndSendMessages(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(notifier.sent) != 1 || notifier.sent[0].Text != "ERROR part 1, part 2" {
+				t.Errorf("unexpected messages: %+v", notifier.sent)
+			}
+		})
+	}
+}
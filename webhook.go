@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	NotifierTypeWebhook = "webhook"
+
+	defaultWebhookTimeout = 10 * time.Second
+)
+
+type WebhookConfig struct {
+	URL        string            `yaml:"url"`
+	Method     string            `yaml:"method"`
+	Headers    map[string]string `yaml:"headers"`
+	TimeoutSec uint              `yaml:"timeout"`
+}
+
+// WebhookNotifier sends the message as JSON by HTTP.
+// The message template, if set, is the request body
+type WebhookNotifier struct {
+	name      string
+	url       string
+	method    string
+	headers   map[string]string
+	templates Templates
+	client    *http.Client
+}
+
+// webhookPayload is the default request body
+type webhookPayload struct {
+	Host      string            `json:"host"`
+	File      string            `json:"file"`
+	FilePath  string            `json:"filePath"`
+	Filter    string            `json:"filter"`
+	Count     int               `json:"count"`
+	FirstSeen time.Time         `json:"firstSeen"`
+	LastSeen  time.Time         `json:"lastSeen"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Lines     []string          `json:"lines,omitempty"`
+	Before    []string          `json:"contextBefore,omitempty"`
+	After     []string          `json:"contextAfter,omitempty"`
+	Subject   string            `json:"subject,omitempty"`
+	Text      string            `json:"text"`
+	ID        string            `json:"id,omitempty"`
+	Status    string            `json:"status"`
+}
+
+func NewWebhookNotifier(cfg NotificationConfig) (*WebhookNotifier, error) {
+	if cfg.WebhookConfig.URL == "" {
+		return nil, fmt.Errorf("webhook url is empty")
+	}
+
+	templates, err := NewTemplates(cfg.Name, cfg.TemplateConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	method := strings.ToUpper(cfg.WebhookConfig.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	timeout := defaultWebhookTimeout
+	if cfg.WebhookConfig.TimeoutSec > 0 {
+		timeout = time.Second * time.Duration(cfg.WebhookConfig.TimeoutSec)
+	}
+
+	return &WebhookNotifier{
+		name:      cfg.Name,
+		url:       cfg.WebhookConfig.URL,
+		method:    method,
+		headers:   cfg.WebhookConfig.Headers,
+		templates: templates,
+		client:    &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Render builds the request body: the message template with JSON escaped values
+// if it's set for the webhook, or the JSON payload with the filter message
+func (wn *WebhookNotifier) Render(msg *Message) error {
+	templates := msg.Filter.NotifierTemplates[wn.name].merge(wn.templates)
+	if templates.Text != nil {
+		return msg.Render(wn.name, wn.templates, escapeJSON)
+	}
+
+	data := msg.data()
+
+	if err := msg.Render(wn.name, wn.templates, nil); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Host:      data.Host,
+		File:      data.File,
+		FilePath:  data.FilePath,
+		Filter:    data.Filter,
+		Count:     data.Count,
+		FirstSeen: data.FirstSeen,
+		LastSeen:  data.LastSeen,
+		Fields:    data.Fields,
+		Lines:     data.Lines,
+		Before:    data.ContextBefore,
+		After:     data.ContextAfter,
+		Subject:   msg.Subject,
+		Text:      msg.Text,
+		ID:        data.AlertID,
+		Status:    data.Status,
+	})
+	if err != nil {
+		return err
+	}
+
+	msg.Text = string(body)
+
+	return nil
+}
+
+func (wn *WebhookNotifier) Send(ctx context.Context, msg Message) (string, error) {
+	if err := wn.Render(&msg); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, wn.method, wn.url, bytes.NewBufferString(msg.Text))
+	if err != nil {
+		return "", fmt.Errorf("webhook request error: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range wn.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("webhook send error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("webhook response status: %s", resp.Status)
+	}
+
+	// the resolved message is correlated by the alert ID in the payload
+	return "", nil
+}
+
+func (wn *WebhookNotifier) Name() string {
+	return wn.name
+}
+
+func (wn *WebhookNotifier) Type() string {
+	return NotifierTypeWebhook
+}
+
+func (wn *WebhookNotifier) Close() error {
+	wn.client.CloseIdleConnections()
+	return nil
+}
+
+// escapeJSON escapes the text as a JSON string without quotes
+func escapeJSON(text string) string {
+	b, _ := json.Marshal(text)
+	return string(b[1 : len(b)-1])
+}
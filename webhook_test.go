@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var (
+		body   []byte
+		header http.Header
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		cfg       NotificationConfig
+		templates map[string]TemplateConfig
+		expected  map[string]interface{}
+	}{
+		{
+			"1. Default payload",
+			NotificationConfig{},
+			nil,
+			map[string]interface{}{
+				"host": "web1", "file": "app", "filePath": "/var/log/app.log", "filter": "Error", "count": 2.0,
+				"firstSeen": "0001-01-01T00:00:00Z", "lastSeen": "0001-01-01T00:00:00Z",
+				"fields": map[string]interface{}{"user": "al\"ice"}, "lines": []interface{}{`ERROR "quoted"`},
+				"subject": "Error on web1", "text": `app: ERROR "quoted"`, "status": "firing",
+			},
+		},
+		{
+			"2. Notifier template",
+			NotificationConfig{TemplateConfig: TemplateConfig{Message: `{"text":"{{ .Text }}","user":"{{ .Fields.user }}"}`}},
+			nil,
+			map[string]interface{}{"text": `ERROR "quoted"`, "user": "al\"ice"},
+		},
+		{
+			"3. Filter template for the notifier",
+			NotificationConfig{TemplateConfig: TemplateConfig{Message: `{"text":"{{ .Text }}"}`}},
+			map[string]TemplateConfig{"hook": {Message: `{"count":{{ .Count }}}`}},
+			map[string]interface{}{"count": 2.0},
+		},
+		{
+			"4. Legacy notifier template",
+			NotificationConfig{TemplateConfig: TemplateConfig{Message: `{"text": "%text", "count": %count, "user": "%{user}"}`}},
+			nil,
+			map[string]interface{}{"count": 2.0, "text": `ERROR "quoted"`, "user": "al\"ice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Name = "hook"
+			tt.cfg.Type = NotifierTypeWebhook
+			tt.cfg.URL = server.URL
+			tt.cfg.Headers = map[string]string{"Authorization": "Bearer token"}
+
+			notifier, err := NewNotifier(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter, err := NewFilter(FilterConfig{
+				Name:          "Error",
+				Message:       "%filename: %text",
+				Subject:       "{{ .Filter }} on {{ .Host }}",
+				Notifications: []string{"hook"},
+				Templates:     tt.templates,
+			}, "web1", []Notifier{notifier}, &Grok{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = notifier.Send(context.Background(), Message{
+				FileName: "app",
+				FilePath: "/var/log/app.log",
+				Text:     `ERROR "quoted"`,
+				Count:    2,
+				Lines:    []string{`ERROR "quoted"`},
+				Fields:   map[string]string{"user": "al\"ice"},
+				Filter:   filter,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if header.Get("Authorization") != "Bearer token" || header.Get("Content-Type") != "application/json" {
+				t.Errorf("unexpected headers: %v", header)
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("body %s decode error: %v", body, err)
+			}
+
+			if !jsonEqual(got, tt.expected) {
+				t.Errorf("got %s, expected %v", body, tt.expected)
+			}
+		})
+	}
+}
+
+func jsonEqual(a, b interface{}) bool {
+	aj, _ := json.Marshal(a)
+	bj, _ := json.Marshal(b)
+	return string(aj) == string(bj)
+}